@@ -0,0 +1,227 @@
+package garden_integration_tests_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/config"
+	. "github.com/onsi/gomega"
+)
+
+// bulkParallelism bounds the number of in-flight requests made by the bulk
+// helpers, so that creating many containers does not swamp the server.
+//
+// The loops in performance/ keep their own goroutines: they time every create
+// and destroy on its own, which the aggregated helpers would hide, and that
+// package cannot see these helpers anyway. limits_test.go only ever creates a
+// single sibling container.
+const bulkParallelism = 5
+
+var _ = Describe("Bulk operations", func() {
+	var containers []garden.Container
+	var handles []string
+
+	BeforeEach(func() {
+		containers = []garden.Container{}
+		handles = []string{}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		containers, err = createContainers(6, garden.ContainerSpec{
+			RootFSPath: rootfs,
+			Properties: garden.Properties{"bulk": bulkPropertyValue()},
+		})
+		for _, c := range containers {
+			handles = append(handles, c.Handle())
+		}
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(destroyContainers(handles)).To(Succeed())
+	})
+
+	It("creates all of the containers", func() {
+		Expect(getContainerHandles()).To(ContainElement(handles[0]))
+
+		containers, err := gardenClient.Containers(garden.Properties{"bulk": bulkPropertyValue()})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(containers).To(HaveLen(len(handles)))
+	})
+
+	Describe("BulkInfo", func() {
+		It("returns the same info as Info() for each container", func() {
+			infos, err := containersInfo(handles)
+			Expect(err).ToNot(HaveOccurred())
+
+			bulkInfo, err := gardenClient.BulkInfo(handles)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bulkInfo).To(HaveLen(len(handles)))
+
+			for _, handle := range handles {
+				Expect(bulkInfo).To(HaveKey(handle))
+				Expect(bulkInfo[handle].Err).To(BeNil())
+				Expect(bulkInfo[handle].Info).To(Equal(infos[handle]))
+			}
+		})
+
+		It("reports an error for an unknown handle without failing the others", func() {
+			bulkInfo, err := gardenClient.BulkInfo(append(handles, "does-not-exist"))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(bulkInfo["does-not-exist"].Err).ToNot(BeNil())
+			for _, handle := range handles {
+				Expect(bulkInfo[handle].Err).To(BeNil())
+			}
+		})
+	})
+
+	Describe("BulkMetrics", func() {
+		It("returns the same metrics as Metrics() for each container", func() {
+			bulkMetrics, err := gardenClient.BulkMetrics(handles)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bulkMetrics).To(HaveLen(len(handles)))
+
+			for _, c := range containers {
+				metrics, err := c.Metrics()
+				Expect(err).ToNot(HaveOccurred())
+
+				entry, ok := bulkMetrics[c.Handle()]
+				Expect(ok).To(BeTrue())
+				Expect(entry.Err).To(BeNil())
+
+				Expect(entry.Metrics.DiskStat.TotalBytesUsed).To(BeNumerically("~", metrics.DiskStat.TotalBytesUsed, 1024*1024))
+				Expect(entry.Metrics.DiskStat.ExclusiveBytesUsed).To(BeNumerically("~", metrics.DiskStat.ExclusiveBytesUsed, 1024*1024))
+				Expect(entry.Metrics.MemoryStat.TotalRss).To(BeNumerically("~", metrics.MemoryStat.TotalRss, 1024*1024))
+			}
+		})
+
+		It("reports an error for an unknown handle without failing the others", func() {
+			bulkMetrics, err := gardenClient.BulkMetrics(append(handles, "does-not-exist"))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(bulkMetrics["does-not-exist"].Err).ToNot(BeNil())
+			for _, handle := range handles {
+				Expect(bulkMetrics[handle].Err).To(BeNil())
+			}
+		})
+	})
+})
+
+type bulkError []error
+
+func (e bulkError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d operation(s) failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// forEachConcurrently calls fn for 0..n-1 with at most bulkParallelism calls
+// in flight, and returns every error encountered as a single bulkError.
+func forEachConcurrently(n int, fn func(i int) error) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs bulkError
+	)
+
+	sem := make(chan struct{}, bulkParallelism)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := fn(i); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// bulkPropertyValue is distinct for each parallel node, so that filtering on
+// it only finds the containers created by this node.
+func bulkPropertyValue() string {
+	return fmt.Sprintf("node-%d", config.GinkgoConfig.ParallelNode)
+}
+
+// createContainers creates n containers from spec. Containers that were
+// created are returned even if some of the creates failed.
+func createContainers(n int, spec garden.ContainerSpec) ([]garden.Container, error) {
+	var mu sync.Mutex
+	containers := []garden.Container{}
+
+	err := forEachConcurrently(n, func(i int) error {
+		s := spec
+		if s.Handle != "" {
+			s.Handle = fmt.Sprintf("%s-%d", spec.Handle, i)
+		}
+
+		c, err := gardenClient.Create(s)
+		if err != nil {
+			return fmt.Errorf("create %d: %s", i, err)
+		}
+
+		mu.Lock()
+		containers = append(containers, c)
+		mu.Unlock()
+
+		return nil
+	})
+
+	return containers, err
+}
+
+func containersInfo(handles []string) (map[string]garden.ContainerInfo, error) {
+	var mu sync.Mutex
+	infos := map[string]garden.ContainerInfo{}
+
+	err := forEachConcurrently(len(handles), func(i int) error {
+		c, err := gardenClient.Lookup(handles[i])
+		if err != nil {
+			return fmt.Errorf("lookup %s: %s", handles[i], err)
+		}
+
+		info, err := c.Info()
+		if err != nil {
+			return fmt.Errorf("info %s: %s", handles[i], err)
+		}
+
+		mu.Lock()
+		infos[handles[i]] = info
+		mu.Unlock()
+
+		return nil
+	})
+
+	return infos, err
+}
+
+func destroyContainers(handles []string) error {
+	return forEachConcurrently(len(handles), func(i int) error {
+		if err := gardenClient.Destroy(handles[i]); err != nil {
+			return fmt.Errorf("destroy %s: %s", handles[i], err)
+		}
+
+		return nil
+	})
+}
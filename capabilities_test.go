@@ -0,0 +1,192 @@
+package garden_integration_tests_test
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+// capabilityNames is indexed by capability number, see capability.h.
+var capabilityNames = []string{
+	"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_DAC_READ_SEARCH", "CAP_FOWNER",
+	"CAP_FSETID", "CAP_KILL", "CAP_SETGID", "CAP_SETUID", "CAP_SETPCAP",
+	"CAP_LINUX_IMMUTABLE", "CAP_NET_BIND_SERVICE", "CAP_NET_BROADCAST",
+	"CAP_NET_ADMIN", "CAP_NET_RAW", "CAP_IPC_LOCK", "CAP_IPC_OWNER",
+	"CAP_SYS_MODULE", "CAP_SYS_RAWIO", "CAP_SYS_CHROOT", "CAP_SYS_PTRACE",
+	"CAP_SYS_PACCT", "CAP_SYS_ADMIN", "CAP_SYS_BOOT", "CAP_SYS_NICE",
+	"CAP_SYS_RESOURCE", "CAP_SYS_TIME", "CAP_SYS_TTY_CONFIG", "CAP_MKNOD",
+	"CAP_LEASE", "CAP_AUDIT_WRITE", "CAP_AUDIT_CONTROL", "CAP_SETFCAP",
+	"CAP_MAC_OVERRIDE", "CAP_MAC_ADMIN", "CAP_SYSLOG", "CAP_WAKE_ALARM",
+	"CAP_BLOCK_SUSPEND", "CAP_AUDIT_READ", "CAP_PERFMON", "CAP_BPF",
+	"CAP_CHECKPOINT_RESTORE",
+}
+
+// unprivilegedCapabilities is the complete set of capabilities root may hold
+// in an unprivileged container.
+var unprivilegedCapabilities = []string{
+	"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_FOWNER", "CAP_FSETID", "CAP_KILL",
+	"CAP_SETGID", "CAP_SETUID", "CAP_SETPCAP", "CAP_NET_BIND_SERVICE",
+	"CAP_NET_RAW", "CAP_SYS_CHROOT", "CAP_MKNOD", "CAP_AUDIT_WRITE",
+	"CAP_SETFCAP",
+}
+
+// privilegedDeniedCapabilities are the only capabilities root does not hold
+// in a privileged container.
+var privilegedDeniedCapabilities = []string{
+	"CAP_SYS_TIME",
+}
+
+var _ = Describe("Capabilities", func() {
+	itHasCapabilities := func(rootCapabilities func(supported []string) []string) {
+		It("gives root exactly the allowed effective and bounding capabilities", func() {
+			caps := readCapabilities(container, "root")
+			allowed := rootCapabilities(caps.supported)
+
+			Expect(capabilityDrift(caps.effective, allowed)).To(BeEmpty())
+			Expect(capabilityDrift(caps.bounding, allowed)).To(BeEmpty())
+		})
+
+		It("gives root no ambient capabilities", func() {
+			Expect(readCapabilities(container, "root").ambient).To(BeEmpty())
+		})
+
+		It("gives a non-root user no effective or ambient capabilities", func() {
+			caps := readCapabilities(container, "alice")
+
+			Expect(caps.effective).To(BeEmpty())
+			Expect(caps.ambient).To(BeEmpty())
+		})
+
+		It("gives a non-root user the same bounding set as root", func() {
+			caps := readCapabilities(container, "alice")
+			allowed := rootCapabilities(caps.supported)
+
+			Expect(capabilityDrift(caps.bounding, allowed)).To(BeEmpty())
+		})
+	}
+
+	Context("in an unprivileged container", func() {
+		BeforeEach(func() {
+			privilegedContainer = false
+		})
+
+		itHasCapabilities(func(supported []string) []string {
+			return unprivilegedCapabilities
+		})
+	})
+
+	Context("in a privileged container", func() {
+		BeforeEach(func() {
+			privilegedContainer = true
+		})
+
+		itHasCapabilities(func(supported []string) []string {
+			return without(supported, privilegedDeniedCapabilities)
+		})
+	})
+})
+
+type processCapabilities struct {
+	effective []string
+	bounding  []string
+	ambient   []string
+
+	// supported lists every capability the kernel knows about
+	supported []string
+}
+
+func readCapabilities(container garden.Container, user string) processCapabilities {
+	stdout := gbytes.NewBuffer()
+	process, err := container.Run(garden.ProcessSpec{
+		User: user,
+		Path: "sh",
+		Args: []string{"-c", "grep ^Cap /proc/self/status; echo CapLast: $(cat /proc/sys/kernel/cap_last_cap)"},
+	}, garden.ProcessIO{
+		Stdout: stdout,
+		Stderr: GinkgoWriter,
+	})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(process.Wait()).To(Equal(0))
+
+	fields := map[string]string{}
+	for _, match := range regexp.MustCompile(`(?m)^(Cap\w+):\s*(\S+)$`).FindAllStringSubmatch(string(stdout.Contents()), -1) {
+		fields[match[1]] = match[2]
+	}
+
+	lastCap, err := strconv.Atoi(fields["CapLast"])
+	Expect(err).ToNot(HaveOccurred())
+	Expect(lastCap).To(BeNumerically("<", len(capabilityNames)), "kernel knows capabilities newer than capabilityNames")
+
+	decode := func(field string) []string {
+		if fields[field] == "" {
+			return nil // e.g. CapAmb is missing on kernels older than 4.3
+		}
+
+		mask, err := strconv.ParseUint(fields[field], 16, 64)
+		Expect(err).ToNot(HaveOccurred())
+
+		return capabilitiesInMask(mask)
+	}
+
+	return processCapabilities{
+		effective: decode("CapEff"),
+		bounding:  decode("CapBnd"),
+		ambient:   decode("CapAmb"),
+		supported: capabilityNames[:lastCap+1],
+	}
+}
+
+func capabilitiesInMask(mask uint64) []string {
+	names := []string{}
+	for bit := uint(0); bit < 64; bit++ {
+		if mask&(1<<bit) == 0 {
+			continue
+		}
+
+		if int(bit) < len(capabilityNames) {
+			names = append(names, capabilityNames[bit])
+		} else {
+			names = append(names, fmt.Sprintf("CAP_%d", bit))
+		}
+	}
+
+	return names
+}
+
+// capabilityDrift describes every capability that is held but not allowed,
+// or allowed but not held. It returns an empty slice when they match.
+func capabilityDrift(held, allowed []string) []string {
+	drift := []string{}
+	for _, name := range without(held, allowed) {
+		drift = append(drift, "unexpected "+name)
+	}
+
+	for _, name := range without(allowed, held) {
+		drift = append(drift, "missing "+name)
+	}
+
+	sort.Strings(drift)
+	return drift
+}
+
+func without(names, excluded []string) []string {
+	excludedNames := map[string]bool{}
+	for _, name := range excluded {
+		excludedNames[name] = true
+	}
+
+	result := []string{}
+	for _, name := range names {
+		if !excludedNames[name] {
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
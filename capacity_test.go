@@ -0,0 +1,131 @@
+package garden_integration_tests_test
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/config"
+	. "github.com/onsi/gomega"
+)
+
+// maxContainersToExhaust caps how many containers the exhaustion spec is
+// willing to create, to keep it from running for an unreasonable time
+// against servers that report a very large MaxContainers.
+const maxContainersToExhaust = 256
+
+var _ = Describe("Capacity", func() {
+	var capacity garden.Capacity
+
+	JustBeforeEach(func() {
+		var err error
+		capacity, err = gardenClient.Capacity()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("reports memory, disk and container capacity", func() {
+		Expect(capacity.MemoryInBytes).To(BeNumerically(">", 0))
+		Expect(capacity.DiskInBytes).To(BeNumerically(">", 0))
+		Expect(capacity.MaxContainers).To(BeNumerically(">", 0))
+	})
+
+	It("reports the same capacity after creating and destroying containers", func() {
+		for i := 0; i < 3; i++ {
+			containers, err := createContainers(5, garden.ContainerSpec{})
+
+			handles := make([]string, len(containers))
+			for j, c := range containers {
+				handles[j] = c.Handle()
+			}
+			Expect(destroyContainers(handles)).To(Succeed())
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		capacityAfterChurn, err := gardenClient.Capacity()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(capacityAfterChurn).To(Equal(capacity))
+	})
+
+	Context("when the requested limits exceed the capacity", func() {
+		var overCapacity garden.Container
+
+		BeforeEach(func() {
+			overCapacity = nil
+		})
+
+		AfterEach(func() {
+			if overCapacity != nil {
+				Expect(gardenClient.Destroy(overCapacity.Handle())).To(Succeed())
+			}
+		})
+
+		It("fails to create a container with more memory than the server has", func() {
+			var err error
+			overCapacity, err = gardenClient.Create(garden.ContainerSpec{
+				Limits: garden.Limits{
+					Memory: garden.MemoryLimits{LimitInBytes: capacity.MemoryInBytes * 2},
+				},
+			})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("fails to create a container with more disk than the server has", func() {
+			var err error
+			overCapacity, err = gardenClient.Create(garden.ContainerSpec{
+				Limits: garden.Limits{
+					Disk: garden.DiskLimits{
+						ByteHard: capacity.DiskInBytes * 2,
+						Scope:    garden.DiskLimitScopeExclusive,
+					},
+				},
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when MaxContainers containers exist", func() {
+		var handles []string
+
+		BeforeEach(func() {
+			handles = []string{}
+
+			if config.GinkgoConfig.ParallelTotal > 1 {
+				Skip("exhausting container capacity would starve specs running on other nodes")
+			}
+		})
+
+		JustBeforeEach(func() {
+			existing := uint64(len(getContainerHandles()))
+			if capacity.MaxContainers-existing > maxContainersToExhaust {
+				Skip(fmt.Sprintf("server allows %d containers, more than the %d this spec will create", capacity.MaxContainers, maxContainersToExhaust))
+			}
+
+			containers, err := createContainers(int(capacity.MaxContainers-existing), garden.ContainerSpec{})
+			for _, c := range containers {
+				handles = append(handles, c.Handle())
+			}
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(destroyContainers(handles)).To(Succeed())
+		})
+
+		It("fails to create another container with a clear error", func() {
+			c, err := gardenClient.Create(garden.ContainerSpec{})
+			if err == nil {
+				handles = append(handles, c.Handle())
+			}
+			Expect(err).To(MatchError(ContainSubstring("insufficient")))
+		})
+
+		It("can create a container again once one is destroyed", func() {
+			Expect(gardenClient.Destroy(handles[0])).To(Succeed())
+			handles = handles[1:]
+
+			c, err := gardenClient.Create(garden.ContainerSpec{})
+			Expect(err).ToNot(HaveOccurred())
+			handles = append(handles, c.Handle())
+		})
+	})
+})
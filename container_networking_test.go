@@ -0,0 +1,194 @@
+package garden_integration_tests_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/config"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Container networking", func() {
+	var (
+		echoServer      garden.Container
+		otherContainers []garden.Container
+	)
+
+	BeforeEach(func() {
+		echoServer = nil
+		otherContainers = []garden.Container{}
+	})
+
+	AfterEach(func() {
+		if echoServer != nil {
+			Expect(gardenClient.Destroy(echoServer.Handle())).To(Succeed())
+		}
+
+		for _, c := range otherContainers {
+			Expect(gardenClient.Destroy(c.Handle())).To(Succeed())
+		}
+	})
+
+	Context("when containers are on the same subnet", func() {
+		var echoServerIP string
+
+		BeforeEach(func() {
+			network = staticSubnet(0)
+		})
+
+		JustBeforeEach(func() {
+			echoServerIP = startEchoServer(&echoServer, garden.ContainerSpec{
+				RootFSPath: rootfs,
+				Network:    staticSubnet(0),
+			})
+		})
+
+		It("allocates both container IPs from the subnet", func() {
+			info, err := container.Info()
+			Expect(err).ToNot(HaveOccurred())
+
+			_, subnet, err := net.ParseCIDR(staticSubnet(0))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(subnet.Contains(net.ParseIP(info.ContainerIP))).To(BeTrue())
+			Expect(subnet.Contains(net.ParseIP(echoServerIP))).To(BeTrue())
+			Expect(info.ContainerIP).ToNot(Equal(echoServerIP))
+		})
+
+		It("can reach the other container without a NetOut", func() {
+			Expect(checkConnection(container, garden.ProtocolTCP, echoServerIP, echoServerTCPPort)).To(Succeed())
+		})
+	})
+
+	Context("when containers are on different subnets", func() {
+		var echoServerIP string
+
+		BeforeEach(func() {
+			network = staticSubnet(0)
+		})
+
+		JustBeforeEach(func() {
+			echoServerIP = startEchoServer(&echoServer, garden.ContainerSpec{
+				RootFSPath: rootfs,
+				Network:    staticSubnet(1),
+			})
+		})
+
+		It("cannot reach the other container", func() {
+			Expect(checkConnection(container, garden.ProtocolTCP, echoServerIP, echoServerTCPPort)).ToNot(Succeed())
+		})
+
+		It("can reach the other container after a NetOut", func() {
+			Expect(container.NetOut(garden.NetOutRule{
+				Networks: []garden.IPRange{
+					garden.IPRangeFromIP(net.ParseIP(echoServerIP)),
+				},
+			})).To(Succeed())
+
+			Expect(checkConnection(container, garden.ProtocolTCP, echoServerIP, echoServerTCPPort)).To(Succeed())
+		})
+	})
+
+	Context("when a static IP is requested", func() {
+		BeforeEach(func() {
+			network = staticIP(0, 10)
+		})
+
+		It("gives the container that IP", func() {
+			info, err := container.Info()
+			Expect(err).ToNot(HaveOccurred())
+
+			ip, _, err := net.ParseCIDR(staticIP(0, 10))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.ContainerIP).To(Equal(ip.String()))
+		})
+
+		It("fails to create a second container with the same IP", func() {
+			c, err := gardenClient.Create(garden.ContainerSpec{Network: staticIP(0, 10)})
+			if err == nil {
+				otherContainers = append(otherContainers, c)
+			}
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when no network is requested", func() {
+		It("allocates the container IP from the configured pool", func() {
+			pool := os.Getenv("GARDEN_NETWORK_POOL")
+			if pool == "" {
+				Skip("GARDEN_NETWORK_POOL is not set")
+			}
+
+			_, poolNet, err := net.ParseCIDR(pool)
+			Expect(err).ToNot(HaveOccurred())
+
+			info, err := container.Info()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(poolNet.Contains(net.ParseIP(info.ContainerIP))).To(BeTrue())
+		})
+	})
+
+	Context("when a small subnet runs out of IPs", func() {
+		BeforeEach(func() {
+			network = smallSubnet(2)
+		})
+
+		JustBeforeEach(func() {
+			for i := 0; i < 8; i++ {
+				c, err := gardenClient.Create(garden.ContainerSpec{Network: smallSubnet(2)})
+				if err != nil {
+					Expect(err).To(MatchError(ContainSubstring("insufficient")), "creating a container failed for a reason other than running out of IPs")
+					Expect(otherContainers).ToNot(BeEmpty(), "%s ran out of IPs before it could hold a second container", smallSubnet(2))
+					return
+				}
+
+				otherContainers = append(otherContainers, c)
+			}
+
+			Fail(fmt.Sprintf("expected %s to run out of IPs", smallSubnet(2)))
+		})
+
+		It("reuses the IP of a destroyed container", func() {
+			c, err := gardenClient.Create(garden.ContainerSpec{Network: smallSubnet(2)})
+			if err == nil {
+				otherContainers = append(otherContainers, c)
+			}
+			Expect(err).To(MatchError(ContainSubstring("insufficient")))
+
+			info, err := container.Info()
+			Expect(err).ToNot(HaveOccurred())
+			lastIP := info.ContainerIP
+
+			Expect(gardenClient.Destroy(container.Handle())).To(Succeed())
+			container = nil
+
+			c, err = gardenClient.Create(garden.ContainerSpec{Network: smallSubnet(2)})
+			Expect(err).ToNot(HaveOccurred())
+			otherContainers = append(otherContainers, c)
+
+			info, err = c.Info()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.ContainerIP).To(Equal(lastIP))
+		})
+	})
+})
+
+// staticSubnet returns a /24 outside of the server's dynamic pool, distinct
+// for each parallel node so that nodes do not share subnets.
+func staticSubnet(index int) string {
+	return fmt.Sprintf("10.253.%d.0/24", 10*config.GinkgoConfig.ParallelNode+index)
+}
+
+// staticIP returns a specific IP within staticSubnet(index).
+func staticIP(index, host int) string {
+	return fmt.Sprintf("10.253.%d.%d/24", 10*config.GinkgoConfig.ParallelNode+index, host)
+}
+
+// smallSubnet returns a /29 within staticSubnet(index), which only has room
+// for a handful of containers.
+func smallSubnet(index int) string {
+	return fmt.Sprintf("10.253.%d.0/29", 10*config.GinkgoConfig.ParallelNode+index)
+}
@@ -0,0 +1,193 @@
+package garden_integration_tests_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("DNS", func() {
+	readFile := func(path string) string {
+		stdout := gbytes.NewBuffer()
+		process, err := container.Run(garden.ProcessSpec{
+			User: "alice",
+			Path: "cat",
+			Args: []string{path},
+		}, garden.ProcessIO{
+			Stdout: stdout,
+			Stderr: GinkgoWriter,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(process.Wait()).To(Equal(0))
+
+		return string(stdout.Contents())
+	}
+
+	Describe("/etc/resolv.conf", func() {
+		It("has at least one nameserver, none of them on the host's loopback", func() {
+			resolvConf := readFile("/etc/resolv.conf")
+
+			nameservers := regexp.MustCompile(`(?m)^nameserver\s+(\S+)`).FindAllStringSubmatch(resolvConf, -1)
+			Expect(nameservers).ToNot(BeEmpty(), "no nameserver in:\n%s", resolvConf)
+
+			for _, nameserver := range nameservers {
+				ip := net.ParseIP(nameserver[1])
+				Expect(ip).ToNot(BeNil())
+				Expect(ip.IsLoopback()).To(BeFalse(), "the host's loopback resolver is not reachable from a container")
+			}
+		})
+
+		It("uses the configured nameserver", func() {
+			dnsServer := os.Getenv("GARDEN_DNS_SERVER")
+			if dnsServer == "" {
+				Skip("GARDEN_DNS_SERVER is not set")
+			}
+
+			Expect(readFile("/etc/resolv.conf")).To(MatchRegexp(`(?m)^nameserver\s+%s\s*$`, regexp.QuoteMeta(dnsServer)))
+		})
+	})
+
+	Describe("/etc/hosts", func() {
+		It("maps the container's handle to its IP", func() {
+			info, err := container.Info()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(readFile("/etc/hosts")).To(MatchRegexp(`(?m)^%s\s+%s\s*$`, regexp.QuoteMeta(info.ContainerIP), regexp.QuoteMeta(container.Handle())))
+		})
+
+		It("maps localhost to the loopback address", func() {
+			Expect(readFile("/etc/hosts")).To(MatchRegexp(`(?m)^127\.0\.0\.1\s+localhost`))
+		})
+
+		It("resolves the container's own hostname", func() {
+			info, err := container.Info()
+			Expect(err).ToNot(HaveOccurred())
+
+			// ping runs as root, see checkConnection
+			stdout := gbytes.NewBuffer()
+			process, err := container.Run(garden.ProcessSpec{
+				User: "root",
+				Path: "sh",
+				Args: []string{"-c", "ping -c1 -W1 $(hostname) | head -n1"},
+			}, garden.ProcessIO{
+				Stdout: stdout,
+				Stderr: GinkgoWriter,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(process.Wait()).To(Equal(0))
+
+			Expect(stdout).To(gbytes.Say(regexp.QuoteMeta(info.ContainerIP)))
+		})
+	})
+
+	Describe("name resolution", func() {
+		var (
+			dnsServer   garden.Container
+			dnsServerIP string
+		)
+
+		BeforeEach(func() {
+			dnsServer = nil
+		})
+
+		JustBeforeEach(func() {
+			dnsServerIP = startStubDNSServer(&dnsServer, map[string]string{
+				"stub.garden.test": "10.11.12.13",
+			})
+
+			Expect(container.NetOut(garden.NetOutRule{
+				Protocol: garden.ProtocolUDP,
+				Networks: []garden.IPRange{garden.IPRangeFromIP(net.ParseIP(dnsServerIP))},
+				Ports:    []garden.PortRange{garden.PortRangeFromPort(53)},
+			})).To(Succeed())
+
+			process, err := container.Run(garden.ProcessSpec{
+				User: "root",
+				Path: "sh",
+				Args: []string{"-c", fmt.Sprintf("echo nameserver %s > /etc/resolv.conf", dnsServerIP)},
+			}, garden.ProcessIO{
+				Stdout: GinkgoWriter,
+				Stderr: GinkgoWriter,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(process.Wait()).To(Equal(0))
+		})
+
+		AfterEach(func() {
+			if dnsServer != nil {
+				Expect(gardenClient.Destroy(dnsServer.Handle())).To(Succeed())
+			}
+		})
+
+		It("resolves names through the nameserver in /etc/resolv.conf", func() {
+			stdout := gbytes.NewBuffer()
+			process, err := container.Run(garden.ProcessSpec{
+				User: "alice",
+				Path: "nslookup",
+				Args: []string{"stub.garden.test"},
+			}, garden.ProcessIO{
+				Stdout: stdout,
+				Stderr: GinkgoWriter,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(process.Wait()).To(Equal(0))
+
+			Expect(stdout).To(gbytes.Say(`10\.11\.12\.13`))
+		})
+
+		It("fails to resolve names the nameserver does not know", func() {
+			process, err := container.Run(garden.ProcessSpec{
+				User: "alice",
+				Path: "nslookup",
+				Args: []string{"unknown.garden.test"},
+			}, garden.ProcessIO{
+				Stdout: GinkgoWriter,
+				Stderr: GinkgoWriter,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(process.Wait()).ToNot(Equal(0))
+		})
+	})
+})
+
+// startStubDNSServer creates a sibling container running busybox dnsd, which
+// answers A queries for the given names and nothing else. As with
+// startEchoServer, the container is stored in server as soon as it exists. It
+// returns the container's IP.
+func startStubDNSServer(server *garden.Container, records map[string]string) string {
+	var err error
+	*server, err = gardenClient.Create(garden.ContainerSpec{
+		RootFSPath: rootfs,
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	conf := ""
+	for name, ip := range records {
+		conf += fmt.Sprintf("%s %s\n", name, ip)
+	}
+
+	_, err = (*server).Run(garden.ProcessSpec{
+		User: "root",
+		Path: "sh",
+		Args: []string{"-c", "cat > /tmp/dnsd.conf && exec dnsd -c /tmp/dnsd.conf -p 53"},
+	}, garden.ProcessIO{
+		Stdin:  bytes.NewBufferString(conf),
+		Stdout: GinkgoWriter,
+		Stderr: GinkgoWriter,
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	waitForListener(*server, "udp", 53)
+
+	info, err := (*server).Info()
+	Expect(err).ToNot(HaveOccurred())
+
+	return info.ContainerIP
+}
@@ -0,0 +1,170 @@
+package garden_integration_tests_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+const (
+	busyboxRootfs = "docker:///cloudfoundry/garden-busybox"
+
+	// Dockerfile contains:
+	//   ENV PATH /usr/local/bin:/usr/bin:/bin:/from-dockerfile
+	//   ENV TEST test-from-dockerfile
+	//   ENV TEST second-test-from-dockerfile:$TEST
+	// see diego-dockerfiles/with-volume
+	imageEnvRootfs = "docker:///cloudfoundry/with-volume"
+
+	rootSanitizedPath    = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	nonRootSanitizedPath = "/usr/local/bin:/usr/bin:/bin"
+	imagePath            = "/usr/local/bin:/usr/bin:/bin:/from-dockerfile"
+	imageTest            = "second-test-from-dockerfile:test-from-dockerfile"
+)
+
+// environmentCase is one row of the precedence matrix, from lowest to highest
+// precedence: user defaults and sanitized PATH, image ENV, ContainerSpec.Env,
+// ProcessSpec.Env.
+type environmentCase struct {
+	description  string
+	rootfs       string
+	user         string
+	containerEnv []string
+	processEnv   []string
+
+	// expected holds the variables that must be set, and to what
+	expected map[string]string
+}
+
+var environmentMatrix = []environmentCase{
+	{
+		description: "root with no image ENV",
+		rootfs:      busyboxRootfs,
+		user:        "root",
+		expected:    map[string]string{"HOME": "/root", "USER": "root", "PATH": rootSanitizedPath},
+	},
+	{
+		description: "a non-root user with no image ENV",
+		rootfs:      busyboxRootfs,
+		user:        "alice",
+		expected:    map[string]string{"HOME": "/home/alice", "USER": "alice", "PATH": nonRootSanitizedPath},
+	},
+	{
+		description: "root with image ENV",
+		rootfs:      imageEnvRootfs,
+		user:        "root",
+		expected:    map[string]string{"HOME": "/root", "USER": "root", "PATH": imagePath, "TEST": imageTest},
+	},
+	{
+		description: "a non-root user with image ENV",
+		rootfs:      imageEnvRootfs,
+		user:        "bob",
+		expected:    map[string]string{"HOME": "/home/bob", "USER": "bob", "PATH": imagePath, "TEST": imageTest},
+	},
+	{
+		description:  "a non-root user with container env",
+		rootfs:       busyboxRootfs,
+		user:         "alice",
+		containerEnv: []string{"FROM_CONTAINER=container", "HOME=/from-container"},
+		expected:     map[string]string{"FROM_CONTAINER": "container", "HOME": "/from-container", "USER": "alice", "PATH": nonRootSanitizedPath},
+	},
+	{
+		description:  "root with container env overriding image ENV",
+		rootfs:       imageEnvRootfs,
+		user:         "root",
+		containerEnv: []string{"TEST=from-container", "PATH=/from-container:/bin"},
+		expected:     map[string]string{"TEST": "from-container", "PATH": "/from-container:/bin", "HOME": "/root"},
+	},
+	{
+		description:  "a non-root user with container env overriding image ENV",
+		rootfs:       imageEnvRootfs,
+		user:         "bob",
+		containerEnv: []string{"TEST=from-container"},
+		expected:     map[string]string{"TEST": "from-container", "PATH": imagePath, "HOME": "/home/bob"},
+	},
+	{
+		description:  "root with process env overriding container env and image ENV",
+		rootfs:       imageEnvRootfs,
+		user:         "root",
+		containerEnv: []string{"TEST=from-container", "FROM_CONTAINER=container"},
+		processEnv:   []string{"TEST=from-process", "PATH=/from-process:/bin"},
+		expected:     map[string]string{"TEST": "from-process", "PATH": "/from-process:/bin", "FROM_CONTAINER": "container", "HOME": "/root"},
+	},
+	{
+		description:  "a non-root user with process env overriding container env and user defaults",
+		rootfs:       busyboxRootfs,
+		user:         "alice",
+		containerEnv: []string{"SHARED=from-container", "HOME=/from-container"},
+		processEnv:   []string{"SHARED=from-process", "HOME=/nowhere", "USER=someone-else"},
+		expected:     map[string]string{"SHARED": "from-process", "HOME": "/nowhere", "USER": "someone-else", "PATH": nonRootSanitizedPath},
+	},
+	{
+		description:  "a non-root user with process env overriding image ENV",
+		rootfs:       imageEnvRootfs,
+		user:         "bob",
+		containerEnv: []string{"TEST=from-container"},
+		processEnv:   []string{"TEST=from-process"},
+		expected:     map[string]string{"TEST": "from-process", "PATH": imagePath, "HOME": "/home/bob", "USER": "bob"},
+	},
+}
+
+var _ = Describe("Environment precedence", func() {
+	for _, c := range environmentMatrix {
+		c := c
+
+		Context(fmt.Sprintf("for %s", c.description), func() {
+			BeforeEach(func() {
+				rootfs = c.rootfs
+				env = c.containerEnv
+			})
+
+			JustBeforeEach(func() {
+				if c.rootfs == imageEnvRootfs && c.user == "bob" {
+					Expect(runInContainer(container, "root", "adduser -D bob", GinkgoWriter)).To(Equal(0))
+				}
+			})
+
+			It("sets each variable from the source with the highest precedence", func() {
+				environment := readEnvironment(container, c.user, c.processEnv)
+
+				for name, value := range c.expected {
+					Expect(environment).To(HaveKeyWithValue(name, value))
+				}
+			})
+		})
+	}
+})
+
+// readEnvironment returns the environment a process run as user sees. It
+// fails if a variable is set more than once.
+func readEnvironment(container garden.Container, user string, processEnv []string) map[string]string {
+	stdout := gbytes.NewBuffer()
+	process, err := container.Run(garden.ProcessSpec{
+		User: user,
+		Path: "/bin/cat", // by absolute path, as some rows replace PATH
+		Args: []string{"/proc/self/environ"},
+		Env:  processEnv,
+	}, garden.ProcessIO{
+		Stdout: stdout,
+		Stderr: GinkgoWriter,
+	})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(process.Wait()).To(Equal(0))
+
+	environment := map[string]string{}
+	for _, variable := range strings.Split(string(stdout.Contents()), "\x00") {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		Expect(environment).ToNot(HaveKey(parts[0]), "%s is set more than once", parts[0])
+		environment[parts[0]] = parts[1]
+	}
+
+	return environment
+}
@@ -0,0 +1,21 @@
+# Abuse host paths mounted into the container: make read-only mounts
+# writable, or reach host sockets and garden's own host directories.
+
+for socket in /var/run/docker.sock /run/docker.sock /var/vcap/data/garden/garden.sock; do
+  if [ -e "$socket" ]; then
+    echo "host socket $socket is visible" >&2
+    exit 1
+  fi
+done
+
+if ls -d /tmp/garden-host* 2>/dev/null; then
+  echo "garden host directory is visible" >&2
+  exit 1
+fi
+
+grep ' ro[ ,]' /proc/mounts | while read -r _ mountpoint _; do
+  if mount -o remount,rw "$mountpoint" 2>/dev/null; then
+    echo "remounted $mountpoint read-write" >&2
+    exit 1
+  fi
+done || exit 1
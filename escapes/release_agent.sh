@@ -0,0 +1,17 @@
+# Mount a cgroup hierarchy or write to a release_agent, which could point the
+# host kernel at a script to run as root on the host.
+
+mkdir -p /tmp/escape-cgroup
+if mount -t cgroup -o memory cgroup /tmp/escape-cgroup 2>/dev/null; then
+  echo "mounted a cgroup hierarchy" >&2
+  exit 1
+fi
+
+# write back the current agent, so a successful write changes nothing
+for agent in $(find /sys/fs/cgroup -maxdepth 2 -name release_agent 2>/dev/null); do
+  current=$(cat "$agent" 2>/dev/null) || continue
+  if (echo "$current" > "$agent") 2>/dev/null; then
+    echo "wrote to $agent" >&2
+    exit 1
+  fi
+done
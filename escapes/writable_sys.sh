@@ -0,0 +1,20 @@
+# Write to kernel tunables in /sys and /proc that affect the whole host, e.g.
+# registering a usermode helper the kernel runs as root on the host. Each
+# tunable is written its current value, so a successful write changes nothing.
+# Write-only triggers such as /proc/sysrq-trigger are not probed, as any
+# successful write to them would act on the host.
+
+for target in \
+  /proc/sys/kernel/core_pattern \
+  /proc/sys/kernel/modprobe \
+  /sys/kernel/uevent_helper \
+  /sys/kernel/mm/transparent_hugepage/enabled; do
+  [ -e "$target" ] || continue
+
+  # e.g. "always [madvise] never" selects madvise
+  current=$(sed 's/.*\[\(.*\)\].*/\1/' "$target" 2>/dev/null) || continue
+  if (echo "$current" > "$target") 2>/dev/null; then
+    echo "wrote to $target" >&2
+    exit 1
+  fi
+done
@@ -0,0 +1,204 @@
+package garden_integration_tests_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+// mountPolicy is what a path in the container is expected to look like. Empty
+// fields are not checked. fsType and flags apply to the mount the path is on,
+// which is the path itself when fsType is set.
+type mountPolicy struct {
+	fsType string
+	flags  []string
+	owner  string // uid:gid
+	mode   string // octal, as printed by stat -c %a
+}
+
+type filesystemPolicy map[string]mountPolicy
+
+var unprivilegedFilesystemPolicy = filesystemPolicy{
+	"/":        {flags: []string{"rw"}},
+	"/proc":    {fsType: "proc", flags: []string{"ro"}},
+	"/sys":     {fsType: "sysfs", flags: []string{"ro"}},
+	"/dev/shm": {fsType: "tmpfs", flags: []string{"rw"}, mode: "1777"},
+	"/dev/pts": {fsType: "devpts", flags: []string{"rw"}},
+	"/tmp":     {flags: []string{"rw"}, owner: "0:0", mode: "1777"},
+	"/root":    {flags: []string{"rw"}, owner: "0:0"},
+}
+
+var privilegedFilesystemPolicy = unprivilegedFilesystemPolicy.with(filesystemPolicy{
+	"/proc": {fsType: "proc", flags: []string{"rw"}},
+})
+
+var _ = Describe("Filesystem policy", func() {
+	Context("in an unprivileged container", func() {
+		BeforeEach(func() {
+			privilegedContainer = false
+		})
+
+		It("matches the unprivileged filesystem policy", func() {
+			Expect(unprivilegedFilesystemPolicy.deviations(container)).To(BeEmpty())
+		})
+	})
+
+	Context("in a privileged container", func() {
+		BeforeEach(func() {
+			privilegedContainer = true
+		})
+
+		It("matches the privileged filesystem policy", func() {
+			Expect(privilegedFilesystemPolicy.deviations(container)).To(BeEmpty())
+		})
+	})
+})
+
+// with returns a copy of the policy with some paths replaced or added.
+func (policy filesystemPolicy) with(overrides filesystemPolicy) filesystemPolicy {
+	result := filesystemPolicy{}
+	for path, expected := range policy {
+		result[path] = expected
+	}
+
+	for path, expected := range overrides {
+		result[path] = expected
+	}
+
+	return result
+}
+
+// deviations checks every path in the policy against the container's mounts
+// and file modes, and reports each mismatch on its own line.
+func (policy filesystemPolicy) deviations(container garden.Container) []string {
+	paths := []string{}
+	for path := range policy {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	mounts := readMountInfo(container)
+	stats := readOwnerAndMode(container, paths)
+
+	deviations := []string{}
+	for _, path := range paths {
+		expected := policy[path]
+		mount := enclosingMount(mounts, path)
+
+		if expected.fsType != "" {
+			if mount.mountPoint != path {
+				deviations = append(deviations, fmt.Sprintf("%s: expected a %s mount, but it is not a mount point", path, expected.fsType))
+				continue
+			}
+
+			if mount.fsType != expected.fsType {
+				deviations = append(deviations, fmt.Sprintf("%s: expected a %s mount, got %s", path, expected.fsType, mount.fsType))
+			}
+		}
+
+		for _, flag := range expected.flags {
+			if !mount.options[flag] {
+				deviations = append(deviations, fmt.Sprintf("%s: expected %s to be mounted %s", path, mount.mountPoint, flag))
+			}
+		}
+
+		stat, found := stats[path]
+		if !found {
+			deviations = append(deviations, fmt.Sprintf("%s: does not exist", path))
+			continue
+		}
+
+		if expected.owner != "" && stat.owner != expected.owner {
+			deviations = append(deviations, fmt.Sprintf("%s: expected owner %s, got %s", path, expected.owner, stat.owner))
+		}
+
+		if expected.mode != "" && stat.mode != expected.mode {
+			deviations = append(deviations, fmt.Sprintf("%s: expected mode %s, got %s", path, expected.mode, stat.mode))
+		}
+	}
+
+	return deviations
+}
+
+type mountInfo struct {
+	mountPoint string
+	fsType     string
+	options    map[string]bool // per-mount options, not the superblock's
+}
+
+// readMountInfo parses /proc/self/mountinfo in the container, see proc(5).
+func readMountInfo(container garden.Container) []mountInfo {
+	stdout := gbytes.NewBuffer()
+	Expect(runInContainer(container, "root", "cat /proc/self/mountinfo", stdout)).To(Equal(0))
+
+	mounts := []mountInfo{}
+	for _, line := range strings.Split(strings.TrimSpace(string(stdout.Contents())), "\n") {
+		sides := strings.SplitN(line, " - ", 2)
+		Expect(sides).To(HaveLen(2), "malformed mountinfo line %q", line)
+
+		fields := strings.Fields(sides[0])
+		superFields := strings.Fields(sides[1])
+		Expect(len(fields)).To(BeNumerically(">=", 6), "malformed mountinfo line %q", line)
+		Expect(superFields).ToNot(BeEmpty(), "malformed mountinfo line %q", line)
+
+		options := map[string]bool{}
+		for _, option := range strings.Split(fields[5], ",") {
+			options[option] = true
+		}
+
+		mounts = append(mounts, mountInfo{
+			mountPoint: strings.Replace(fields[4], `\040`, " ", -1),
+			fsType:     superFields[0],
+			options:    options,
+		})
+	}
+
+	return mounts
+}
+
+// enclosingMount returns the mount that path is on. Later mounts hide earlier
+// ones on the same mount point.
+func enclosingMount(mounts []mountInfo, path string) mountInfo {
+	var enclosing mountInfo
+	for _, mount := range mounts {
+		prefix := strings.TrimSuffix(mount.mountPoint, "/") + "/"
+		if mount.mountPoint != path && !strings.HasPrefix(path, prefix) {
+			continue
+		}
+
+		if len(mount.mountPoint) >= len(enclosing.mountPoint) {
+			enclosing = mount
+		}
+	}
+
+	return enclosing
+}
+
+type ownerAndMode struct {
+	owner string
+	mode  string
+}
+
+// readOwnerAndMode stats each path in the container. Paths that do not exist
+// are left out.
+func readOwnerAndMode(container garden.Container, paths []string) map[string]ownerAndMode {
+	stdout := gbytes.NewBuffer()
+	runInContainer(container, "root", "stat -c '%n %u:%g %a' "+strings.Join(paths, " "), stdout)
+
+	stats := map[string]ownerAndMode{}
+	for _, line := range strings.Split(strings.TrimSpace(string(stdout.Contents())), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+
+		stats[fields[0]] = ownerAndMode{owner: fields[1], mode: fields[2]}
+	}
+
+	return stats
+}
@@ -2,6 +2,7 @@ package garden_integration_tests_test
 
 import (
 	"os"
+	"os/exec"
 	"testing"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/cloudfoundry-incubator/garden/client"
 	"github.com/cloudfoundry-incubator/garden/client/connection"
 	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/config"
 	. "github.com/onsi/gomega"
 )
 
@@ -23,6 +25,9 @@ var (
 	privilegedContainer bool
 	properties          garden.Properties
 	limits              garden.Limits
+	graceTime           time.Duration
+	network             string
+	env                 []string
 )
 
 func TestGardenIntegrationTests(t *testing.T) {
@@ -36,6 +41,9 @@ func TestGardenIntegrationTests(t *testing.T) {
 		privilegedContainer = false
 		properties = garden.Properties{}
 		limits = garden.Limits{}
+		graceTime = 0
+		network = ""
+		env = []string{}
 		gardenHost = os.Getenv("GARDEN_ADDRESS")
 		gardenClient = client.New(connection.New("tcp", gardenHost))
 	})
@@ -46,6 +54,9 @@ func TestGardenIntegrationTests(t *testing.T) {
 			Privileged: privilegedContainer,
 			Properties: properties,
 			Limits:     limits,
+			GraceTime:  graceTime,
+			Network:    network,
+			Env:        env,
 		})
 
 		if assertContainerCreate {
@@ -73,3 +84,30 @@ func getContainerHandles() []string {
 
 	return handles
 }
+
+// skipUnlessRestartable skips the current spec unless the suite has been
+// told how to restart the garden server under test and runs on a single
+// node, since a restart fails whatever other nodes are doing.
+func skipUnlessRestartable() {
+	if os.Getenv("GARDEN_RESTART_COMMAND") == "" {
+		Skip("GARDEN_RESTART_COMMAND is not set")
+	}
+
+	if config.GinkgoConfig.ParallelTotal > 1 {
+		Skip("restarting the server would fail specs running on other nodes")
+	}
+}
+
+// restartGarden runs the command in $GARDEN_RESTART_COMMAND, which is
+// expected to restart the garden server under test, and waits for the
+// server to come back.
+func restartGarden() {
+	skipUnlessRestartable()
+
+	cmd := exec.Command("sh", "-c", os.Getenv("GARDEN_RESTART_COMMAND"))
+	cmd.Stdout = GinkgoWriter
+	cmd.Stderr = GinkgoWriter
+	Expect(cmd.Run()).To(Succeed())
+
+	Eventually(gardenClient.Ping, "30s").Should(Succeed())
+}
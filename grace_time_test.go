@@ -0,0 +1,148 @@
+package garden_integration_tests_test
+
+import (
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GraceTime", func() {
+	var containerHandle string
+
+	JustBeforeEach(func() {
+		containerHandle = container.Handle()
+	})
+
+	Context("when the container GraceTime is modified", func() {
+		It("should disappear after grace time and before timeout", func() {
+			_, err := gardenClient.Lookup(container.Handle())
+			Expect(err).NotTo(HaveOccurred())
+
+			container.SetGraceTime(500 * time.Millisecond)
+			container = nil // avoid double-destroying in AfterEach
+
+			Eventually(lookup(containerHandle), "10s").Should(HaveOccurred())
+		})
+	})
+
+	Context("when the GraceTime is set in the container spec", func() {
+		BeforeEach(func() {
+			graceTime = 2 * time.Second
+		})
+
+		AfterEach(func() {
+			container = nil // the container is reaped by the server
+		})
+
+		It("is still present before the grace time elapses", func() {
+			Consistently(lookup(containerHandle), "1s").ShouldNot(HaveOccurred())
+		})
+
+		It("should disappear after grace time and before timeout", func() {
+			Eventually(lookup(containerHandle), "10s").Should(HaveOccurred())
+		})
+
+		Context("and a process is running with its output attached", func() {
+			It("is not reaped until the process exits", func() {
+				process, err := container.Run(garden.ProcessSpec{
+					User: "alice",
+					Path: "sleep",
+					Args: []string{"4"},
+				}, garden.ProcessIO{
+					Stdout: GinkgoWriter,
+					Stderr: GinkgoWriter,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				Consistently(lookup(containerHandle), "3s").ShouldNot(HaveOccurred())
+				Expect(process.Wait()).To(Equal(0))
+
+				Eventually(lookup(containerHandle), "10s").Should(HaveOccurred())
+			})
+		})
+
+		Context("and a second client attaches to a running process", func() {
+			It("is not reaped while the attached stream is open", func() {
+				process, err := container.Run(garden.ProcessSpec{
+					User: "alice",
+					Path: "sleep",
+					Args: []string{"4"},
+				}, garden.ProcessIO{})
+				Expect(err).ToNot(HaveOccurred())
+
+				attached, err := container.Attach(process.ID(), garden.ProcessIO{
+					Stdout: GinkgoWriter,
+					Stderr: GinkgoWriter,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				Consistently(lookup(containerHandle), "3s").ShouldNot(HaveOccurred())
+				Expect(attached.Wait()).To(Equal(0))
+
+				Eventually(lookup(containerHandle), "10s").Should(HaveOccurred())
+			})
+		})
+
+		Context("and the container keeps being used", func() {
+			It("resets the grace time on every request", func() {
+				for i := 0; i < 6; i++ {
+					process, err := container.Run(garden.ProcessSpec{
+						User: "alice",
+						Path: "true",
+					}, garden.ProcessIO{})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(process.Wait()).To(Equal(0))
+
+					time.Sleep(500 * time.Millisecond)
+				}
+
+				_, err := gardenClient.Lookup(containerHandle)
+				Expect(err).ToNot(HaveOccurred())
+
+				Eventually(lookup(containerHandle), "10s").Should(HaveOccurred())
+			})
+		})
+
+		Context("and files are being streamed out", func() {
+			JustBeforeEach(func() {
+				process, err := container.Run(garden.ProcessSpec{
+					User: "alice",
+					Path: "dd",
+					Args: []string{"if=/dev/zero", "of=/home/alice/some-file", "bs=1M", "count=10"},
+				}, garden.ProcessIO{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(process.Wait()).To(Equal(0))
+			})
+
+			It("is not reaped until the stream is closed", func() {
+				tarOutput, err := container.StreamOut(garden.StreamOutSpec{
+					User: "alice",
+					Path: "/home/alice/some-file",
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				_, err = io.CopyN(ioutil.Discard, tarOutput, 1024)
+				Expect(err).ToNot(HaveOccurred())
+
+				Consistently(lookup(containerHandle), "3s").ShouldNot(HaveOccurred())
+
+				_, err = io.Copy(ioutil.Discard, tarOutput)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tarOutput.Close()).To(Succeed())
+
+				Eventually(lookup(containerHandle), "10s").Should(HaveOccurred())
+			})
+		})
+	})
+})
+
+func lookup(handle string) func() error {
+	return func() error {
+		_, err := gardenClient.Lookup(handle)
+		return err
+	}
+}
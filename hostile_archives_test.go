@@ -0,0 +1,260 @@
+package garden_integration_tests_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Streaming in hostile archives", func() {
+	const destination = "/home/alice/destination"
+
+	JustBeforeEach(func() {
+		Expect(runInContainer(container, "alice", "mkdir -p "+destination, GinkgoWriter)).To(Equal(0))
+	})
+
+	itKeepsTheArchiveInsideTheDestination := func(user string) {
+		streamIn := func(entries ...tarEntry) {
+			err := container.StreamIn(garden.StreamInSpec{
+				User:      user,
+				Path:      destination,
+				TarStream: tarStream(entries...),
+			})
+			fmt.Fprintf(GinkgoWriter, "streaming in as %s: %v\n", user, err)
+		}
+
+		AfterEach(func() {
+			// rejecting an entry is fine, but whatever was written must belong to
+			// the user it was streamed in as
+			Expect(filesNotOwnedBy(destination, user)).To(BeEmpty())
+		})
+
+		It("does not write entries with ../ outside the destination", func() {
+			streamIn(
+				tarFile("../../../tmp/dot-dot-escaped", "escaped"),
+				tarFile("inner/../../dot-dot-escaped-again", "escaped"),
+			)
+
+			Expect(findOutside(destination, "dot-dot-escaped")).To(BeEmpty())
+			Expect(findOutside(destination, "dot-dot-escaped-again")).To(BeEmpty())
+		})
+
+		It("does not write entries with absolute paths outside the destination", func() {
+			streamIn(tarFile("/tmp/absolute-escaped", "escaped"))
+
+			Expect(findOutside(destination, "absolute-escaped")).To(BeEmpty())
+		})
+
+		It("does not write through a symlink pointing outside the destination", func() {
+			streamIn(
+				tarSymlink("to-tmp", "/tmp"),
+				tarSymlink("to-etc", "../../../etc"),
+				tarFile("to-tmp/symlink-escaped", "escaped"),
+				tarFile("to-etc/symlink-escaped-again", "escaped"),
+			)
+
+			Expect(findOutside(destination, "symlink-escaped")).To(BeEmpty())
+			Expect(findOutside(destination, "symlink-escaped-again")).To(BeEmpty())
+		})
+
+		Context("when the archive hard links to /etc/shadow", func() {
+			var shadowBefore string
+
+			JustBeforeEach(func() {
+				Expect(runInContainer(container, "root", "test -e /etc/shadow || (echo 'root:*:16000:0:99999:7:::' > /etc/shadow && chmod 600 /etc/shadow)", GinkgoWriter)).To(Equal(0))
+				shadowBefore = checksum("/etc/shadow")
+			})
+
+			It("neither modifies nor exposes /etc/shadow", func() {
+				streamIn(
+					tarHardlink("shadow", "/etc/shadow"),
+					tarHardlink("shadow-again", "../../../etc/shadow"),
+					tarFile("shadow", "root::0:0:99999:7:::\n"),
+				)
+
+				Expect(checksum("/etc/shadow")).To(Equal(shadowBefore))
+				for _, link := range []string{"shadow", "shadow-again"} {
+					path := destination + "/" + link
+					Expect(runInContainer(container, "root", fmt.Sprintf(`[ ! %s -ef /etc/shadow ]`, path), GinkgoWriter)).To(Equal(0), "%s is a hard link to /etc/shadow", path)
+				}
+			})
+		})
+
+		It("does not create a usable device node", func() {
+			streamIn(
+				tarDevice("mem", tar.TypeChar, 1, 1),
+				tarDevice("sda", tar.TypeBlock, 8, 0),
+			)
+
+			// refusing to create a node at all is the safest outcome
+			for path, test := range map[string]string{destination + "/mem": "-c", destination + "/sda": "-b"} {
+				if runInContainer(container, "root", fmt.Sprintf("[ %s %s ]", test, path), GinkgoWriter) == 0 {
+					expectOpenDenied(container, path)
+				}
+			}
+		})
+
+		It("does not create a setuid file owned by anyone else", func() {
+			streamIn(tarEntry{
+				header: &tar.Header{Name: "setuid", Mode: 04755, Uid: 0, Gid: 0, Typeflag: tar.TypeReg},
+				body:   "#!/bin/sh\nid -u\n",
+			})
+
+			stdout := gbytes.NewBuffer()
+			Expect(runInContainer(container, "root", fmt.Sprintf("find %s -perm -4000 ! -user %s", destination, user), stdout)).To(Equal(0))
+			Expect(stdout.Contents()).To(BeEmpty())
+		})
+	}
+
+	Context("when streaming in as a non-root user", func() {
+		itKeepsTheArchiveInsideTheDestination("alice")
+	})
+
+	Context("when streaming in as root", func() {
+		itKeepsTheArchiveInsideTheDestination("root")
+	})
+
+	Context("when the archive holds a file larger than the disk limit", func() {
+		const hugeFileSize = 256 * 1024 * 1024
+
+		BeforeEach(func() {
+			limits.Disk.ByteSoft = 32 * 1024 * 1024
+			limits.Disk.ByteHard = 32 * 1024 * 1024
+			limits.Disk.Scope = garden.DiskLimitScopeExclusive
+		})
+
+		It("fails without using more than the limit", func() {
+			// archive/tar cannot write sparse entries, so the file is sent in full;
+			// the zeros are generated as they are streamed
+			reader, writer := io.Pipe()
+			go func() {
+				tarWriter := tar.NewWriter(writer)
+				err := tarWriter.WriteHeader(&tar.Header{Name: "huge", Mode: 0644, Size: hugeFileSize})
+				if err == nil {
+					_, err = io.CopyN(tarWriter, zeros{}, hugeFileSize)
+				}
+				if err == nil {
+					err = tarWriter.Close()
+				}
+
+				writer.CloseWithError(err)
+			}()
+
+			err := container.StreamIn(garden.StreamInSpec{
+				User:      "alice",
+				Path:      destination,
+				TarStream: reader,
+			})
+			reader.Close()
+			Expect(err).To(HaveOccurred())
+
+			stdout := gbytes.NewBuffer()
+			Expect(runInContainer(container, "root", "du -sk "+destination+" | cut -f1", stdout)).To(Equal(0))
+
+			usedKB, err := strconv.Atoi(strings.TrimSpace(string(stdout.Contents())))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(usedKB * 1024).To(BeNumerically("<=", limits.Disk.ByteHard))
+		})
+	})
+})
+
+type tarEntry struct {
+	header *tar.Header
+	body   string
+}
+
+func tarFile(name, body string) tarEntry {
+	return tarEntry{
+		header: &tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg},
+		body:   body,
+	}
+}
+
+func tarSymlink(name, target string) tarEntry {
+	return tarEntry{
+		header: &tar.Header{Name: name, Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: target},
+	}
+}
+
+func tarHardlink(name, target string) tarEntry {
+	return tarEntry{
+		header: &tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeLink, Linkname: target},
+	}
+}
+
+func tarDevice(name string, typeflag byte, major, minor int64) tarEntry {
+	return tarEntry{
+		header: &tar.Header{Name: name, Mode: 0666, Typeflag: typeflag, Devmajor: major, Devminor: minor},
+	}
+}
+
+// tarStream returns an uncompressed tar stream holding the entries in order,
+// without checking that they are safe to extract.
+func tarStream(entries ...tarEntry) io.Reader {
+	buffer := new(bytes.Buffer)
+	writer := tar.NewWriter(buffer)
+
+	for _, entry := range entries {
+		entry.header.Size = int64(len(entry.body))
+		Expect(writer.WriteHeader(entry.header)).To(Succeed())
+
+		_, err := writer.Write([]byte(entry.body))
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	Expect(writer.Close()).To(Succeed())
+
+	return buffer
+}
+
+// findOutside returns every file in the container with the given name that
+// is not inside directory.
+func findOutside(directory, name string) []string {
+	stdout := gbytes.NewBuffer()
+	Expect(runInContainer(container, "root", fmt.Sprintf(
+		"find / \\( -path /proc -o -path /sys -o -path /dev \\) -prune -o -name %s -print", name,
+	), stdout)).To(Equal(0))
+
+	outside := []string{}
+	for _, path := range strings.Fields(string(stdout.Contents())) {
+		if !strings.HasPrefix(path, directory+"/") {
+			outside = append(outside, path)
+		}
+	}
+
+	return outside
+}
+
+// filesNotOwnedBy returns every file below directory that is not owned by
+// user, including symlinks themselves.
+func filesNotOwnedBy(directory, user string) []string {
+	stdout := gbytes.NewBuffer()
+	Expect(runInContainer(container, "root", fmt.Sprintf("find %s -mindepth 1 ! -user %s", directory, user), stdout)).To(Equal(0))
+
+	return strings.Fields(string(stdout.Contents()))
+}
+
+func checksum(path string) string {
+	stdout := gbytes.NewBuffer()
+	Expect(runInContainer(container, "root", "md5sum "+path, stdout)).To(Equal(0))
+
+	return string(stdout.Contents())
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,74 @@
+/*
+ * syscall-probe attempts a catalogue of dangerous syscalls and prints one
+ * line per syscall:
+ *
+ *   <name>: denied <errno name>
+ *   <name>: allowed
+ *
+ * A syscall counts as denied when it fails with EPERM, EACCES or ENOSYS, i.e.
+ * when it was refused before doing any work. Any other outcome, including
+ * failing on the (deliberately invalid) arguments, means the kernel let the
+ * call through. The probes are chosen so that nothing harmful happens even
+ * when a call is allowed.
+ */
+#define _GNU_SOURCE
+#include <errno.h>
+#include <sched.h>
+#include <signal.h>
+#include <stdio.h>
+#include <string.h>
+#include <sys/mount.h>
+#include <sys/ptrace.h>
+#include <sys/reboot.h>
+#include <sys/syscall.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#ifndef SYS_bpf
+#define SYS_bpf 321 /* x86_64; missing from older headers */
+#endif
+
+static void report(const char *name, long result) {
+  if (result == -1 && (errno == EPERM || errno == EACCES || errno == ENOSYS)) {
+    printf("%s: denied %s\n", name,
+           errno == EPERM ? "EPERM" : errno == EACCES ? "EACCES" : "ENOSYS");
+  } else {
+    printf("%s: allowed\n", name);
+  }
+}
+
+int main(void) {
+  errno = 0;
+  report("mount", mount("none", "/tmp", "tmpfs", MS_RDONLY, NULL));
+  umount("/tmp");
+
+  errno = 0;
+  report("kexec_load", syscall(SYS_kexec_load, 0, 0, NULL, 0xffffffffUL));
+
+  errno = 0;
+  report("reboot", reboot(RB_DISABLE_CAD));
+
+  /* trace a child of our own, and seize rather than attach so that it is
+   * never stopped, even when ptrace is allowed */
+  pid_t child = fork();
+  if (child == 0) {
+    pause();
+    _exit(0);
+  }
+  errno = 0;
+  report("ptrace", ptrace(PTRACE_SEIZE, child, NULL, NULL));
+  kill(child, SIGKILL);
+  waitpid(child, NULL, 0);
+
+  errno = 0;
+  report("keyctl", syscall(SYS_keyctl, 0 /* KEYCTL_GET_KEYRING_ID */,
+                           -3 /* KEY_SPEC_SESSION_KEYRING */, 0));
+
+  errno = 0;
+  report("bpf", syscall(SYS_bpf, 0 /* BPF_MAP_CREATE */, NULL, 0));
+
+  errno = 0;
+  report("unshare_user", unshare(CLONE_NEWUSER));
+
+  return 0;
+}
@@ -453,28 +453,6 @@ var _ = Describe("Lifecycle", func() {
 			})
 		})
 
-		Context("with a memory limit", func() {
-			JustBeforeEach(func() {
-				err := container.LimitMemory(garden.MemoryLimits{
-					LimitInBytes: 64 * 1024 * 1024,
-				})
-				Expect(err).ToNot(HaveOccurred())
-			})
-
-			Context("when the process writes too much to /dev/shm", func() {
-				It("is killed", func() {
-					process, err := container.Run(garden.ProcessSpec{
-						User: "alice",
-						Path: "dd",
-						Args: []string{"if=/dev/urandom", "of=/dev/shm/too-big", "bs=1M", "count=65"},
-					}, garden.ProcessIO{})
-					Expect(err).ToNot(HaveOccurred())
-
-					Expect(process.Wait()).ToNot(Equal(0))
-				})
-			})
-		})
-
 		Context("with a tty", func() {
 			It("executes the process with a raw tty with the given window size", func() {
 				stdout := gbytes.NewBuffer()
@@ -726,9 +704,7 @@ var _ = Describe("Lifecycle", func() {
 
 					exitStatus, err := process.Wait()
 					Expect(err).ToNot(HaveOccurred())
-					if exitStatus != 137 && exitStatus != 255 {
-						Fail(fmt.Sprintf("Unexpected exitStatus: %d", exitStatus))
-					}
+					expectKilled(exitStatus)
 
 					Expect(time.Since(stoppedAt)).To(BeNumerically(">=", 10*time.Second))
 				})
@@ -981,20 +957,12 @@ var _ = Describe("Lifecycle", func() {
 			})
 		})
 	})
-
-	Context("when the container GraceTime is modified", func() {
-		It("should disappear after grace time and before timeout", func() {
-			_, err := gardenClient.Lookup(container.Handle())
-			Expect(err).NotTo(HaveOccurred())
-
-			container.SetGraceTime(500 * time.Millisecond)
-			containerHandle := container.Handle()
-			container = nil // avoid double-destroying in AfterEach
-
-			Eventually(func() error {
-				_, err := gardenClient.Lookup(containerHandle)
-				return err
-			}, "10s").Should(HaveOccurred())
-		})
-	})
 })
+
+// expectKilled checks the exit status of a process that was SIGKILLed, e.g.
+// by Stop or the OOM killer. Backends report it as either 137 or 255.
+func expectKilled(exitStatus int) {
+	if exitStatus != 137 && exitStatus != 255 {
+		Fail(fmt.Sprintf("Unexpected exitStatus: %d", exitStatus))
+	}
+}
@@ -1,8 +1,16 @@
 package garden_integration_tests_test
 
 import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
 	"github.com/cloudfoundry-incubator/garden"
 	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/config"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 )
@@ -30,6 +38,267 @@ var _ = Describe("Limits", func() {
 				})
 			})
 		})
+
+		Context("when allocating anonymous memory", func() {
+			BeforeEach(func() {
+				rootfs = "docker:///ubuntu"
+				limits.Memory = garden.MemoryLimits{LimitInBytes: 64 * 1024 * 1024}
+			})
+
+			JustBeforeEach(func() {
+				// the ubuntu image has no alice user
+				Expect(runInContainer(container, "root", "useradd -U -m alice", GinkgoWriter)).To(Equal(0))
+			})
+
+			It("lets a process allocate just under the limit", func() {
+				Expect(allocateMemory(container, 40)).To(Equal(0))
+			})
+
+			It("kills a process allocating over the limit", func() {
+				expectKilled(allocateMemory(container, 80))
+			})
+
+			It("surfaces an out of memory event", func() {
+				expectKilled(allocateMemory(container, 80))
+
+				Eventually(func() []string {
+					info, err := container.Info()
+					Expect(err).ToNot(HaveOccurred())
+					return info.Events
+				}).Should(ContainElement("out of memory"))
+			})
+
+			It("does not report an out of memory event when the limit is not hit", func() {
+				Expect(allocateMemory(container, 40)).To(Equal(0))
+
+				info, err := container.Info()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(info.Events).ToNot(ContainElement("out of memory"))
+			})
+
+			Context("when the limit is increased at runtime", func() {
+				JustBeforeEach(func() {
+					Expect(container.LimitMemory(garden.MemoryLimits{LimitInBytes: 128 * 1024 * 1024})).To(Succeed())
+				})
+
+				It("reports the new limit", func() {
+					memoryLimits, err := container.CurrentMemoryLimits()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(memoryLimits).To(Equal(garden.MemoryLimits{LimitInBytes: 128 * 1024 * 1024}))
+				})
+
+				It("lets a process allocate more than the old limit", func() {
+					Expect(allocateMemory(container, 80)).To(Equal(0))
+				})
+			})
+
+			Context("when the limit is decreased at runtime", func() {
+				JustBeforeEach(func() {
+					Expect(container.LimitMemory(garden.MemoryLimits{LimitInBytes: 32 * 1024 * 1024})).To(Succeed())
+				})
+
+				It("reports the new limit", func() {
+					memoryLimits, err := container.CurrentMemoryLimits()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(memoryLimits).To(Equal(garden.MemoryLimits{LimitInBytes: 32 * 1024 * 1024}))
+				})
+
+				It("kills a process allocating less than the old limit", func() {
+					expectKilled(allocateMemory(container, 40))
+				})
+			})
+		})
+
+		Describe("Metrics", func() {
+			BeforeEach(func() {
+				rootfs = "docker:///ubuntu"
+			})
+
+			JustBeforeEach(func() {
+				// the ubuntu image has no alice user
+				Expect(runInContainer(container, "root", "useradd -U -m alice", GinkgoWriter)).To(Equal(0))
+			})
+
+			It("reports rss growing while a process holds memory", func() {
+				metrics, err := container.Metrics()
+				Expect(err).ToNot(HaveOccurred())
+				initialRss := metrics.MemoryStat.TotalRss
+
+				_, err = container.Run(garden.ProcessSpec{
+					User: "alice",
+					Path: "perl",
+					Args: []string{"-e", `my $x = "a" x (32 * 1024 * 1024); print "allocated\n"; sleep 30`},
+				}, garden.ProcessIO{
+					Stdout: GinkgoWriter,
+					Stderr: GinkgoWriter,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				Eventually(func() uint64 {
+					metrics, err := container.Metrics()
+					Expect(err).ToNot(HaveOccurred())
+					return metrics.MemoryStat.TotalRss
+				}).Should(BeNumerically(">=", initialRss+30*1024*1024))
+			})
+
+			It("reports cache growing when files are written", func() {
+				metrics, err := container.Metrics()
+				Expect(err).ToNot(HaveOccurred())
+				initialCache := metrics.MemoryStat.TotalCache
+
+				process, err := container.Run(garden.ProcessSpec{
+					User: "alice",
+					Path: "dd",
+					Args: []string{"if=/dev/zero", "of=/home/alice/cached-file", "bs=1M", "count=20"},
+				}, garden.ProcessIO{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(process.Wait()).To(Equal(0))
+
+				Eventually(func() uint64 {
+					metrics, err := container.Metrics()
+					Expect(err).ToNot(HaveOccurred())
+					return metrics.MemoryStat.TotalCache
+				}).Should(BeNumerically(">=", initialCache+15*1024*1024))
+			})
+
+			It("reports hierarchical totals no smaller than the container's own cache and rss", func() {
+				metrics, err := container.Metrics()
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(metrics.MemoryStat.TotalRss).To(BeNumerically(">=", metrics.MemoryStat.Rss))
+				Expect(metrics.MemoryStat.TotalCache).To(BeNumerically(">=", metrics.MemoryStat.Cache))
+			})
+		})
+	})
+
+	// There are no specs for a pids limit: the garden client this suite is
+	// built against has no Limits.Pid, nor a call to change one at runtime.
+
+	Describe("LimitCPU", func() {
+		var otherContainer garden.Container
+
+		BeforeEach(func() {
+			otherContainer = nil
+
+			if config.GinkgoConfig.ParallelTotal > 1 {
+				Skip("CPU shares only split CPU time predictably when nothing else competes for it")
+			}
+
+			rootfs = "docker:///cloudfoundry/ubuntu-bc"
+			limits.CPU = garden.CPULimits{LimitInShares: 512}
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			otherContainer, err = gardenClient.Create(garden.ContainerSpec{
+				RootFSPath: rootfs,
+				Limits: garden.Limits{
+					CPU: garden.CPULimits{LimitInShares: 1024},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			startCPULoad(container)
+			startCPULoad(otherContainer)
+		})
+
+		AfterEach(func() {
+			if otherContainer != nil {
+				Expect(gardenClient.Destroy(otherContainer.Handle())).To(Succeed())
+			}
+		})
+
+		It("gives each container CPU time in proportion to its shares", func() {
+			usage := cpuUsageOver(10*time.Second, container, otherContainer)
+
+			Expect(float64(usage[0]) / float64(usage[1])).To(BeNumerically("~", 0.5, 0.15))
+		})
+
+		Context("when the shares are changed on a running container", func() {
+			JustBeforeEach(func() {
+				Expect(container.LimitCPU(garden.CPULimits{LimitInShares: 2048})).To(Succeed())
+			})
+
+			It("reports the new limit", func() {
+				cpuLimits, err := container.CurrentCPULimits()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cpuLimits).To(Equal(garden.CPULimits{LimitInShares: 2048}))
+			})
+
+			It("rebalances CPU time according to the new shares", func() {
+				usage := cpuUsageOver(10*time.Second, container, otherContainer)
+
+				Expect(float64(usage[0]) / float64(usage[1])).To(BeNumerically("~", 2, 0.6))
+			})
+		})
+	})
+
+	Describe("LimitBandwidth", func() {
+		const (
+			rate          = 256 * 1024
+			burst         = 64 * 1024
+			transferBytes = 2 * 1024 * 1024
+		)
+
+		var hostPort uint32
+
+		itStaysWithinTheLimit := func() {
+			It("reports the limit", func() {
+				bandwidthLimits, err := container.CurrentBandwidthLimits()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(bandwidthLimits).To(Equal(garden.BandwidthLimits{
+					RateInBytesPerSecond:      rate,
+					BurstRateInBytesPerSecond: burst,
+				}))
+			})
+
+			It("keeps the throughput of a NetIn port within the limit", func() {
+				bytesPerSecond := measureThroughput(hostPort, transferBytes)
+
+				Expect(bytesPerSecond).To(BeNumerically("<=", rate*1.25))
+				Expect(bytesPerSecond).To(BeNumerically(">=", rate*0.5))
+			})
+		}
+
+		JustBeforeEach(func() {
+			var err error
+			hostPort, _, err = container.NetIn(0, 8080)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = container.Run(garden.ProcessSpec{
+				User: "root",
+				Path: "sh",
+				Args: []string{"-c", fmt.Sprintf("while true; do head -c %d /dev/zero | nc -l -p 8080; done", transferBytes)},
+			}, garden.ProcessIO{
+				Stdout: GinkgoWriter,
+				Stderr: GinkgoWriter,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			waitForListener(container, "tcp", 8080)
+		})
+
+		Context("when the limit is set in the container spec", func() {
+			BeforeEach(func() {
+				limits.Bandwidth = garden.BandwidthLimits{
+					RateInBytesPerSecond:      rate,
+					BurstRateInBytesPerSecond: burst,
+				}
+			})
+
+			itStaysWithinTheLimit()
+		})
+
+		Context("when the limit is set on a running container", func() {
+			JustBeforeEach(func() {
+				Expect(container.LimitBandwidth(garden.BandwidthLimits{
+					RateInBytesPerSecond:      rate,
+					BurstRateInBytesPerSecond: burst,
+				})).To(Succeed())
+			})
+
+			itStaysWithinTheLimit()
+		})
 	})
 
 	Describe("LimitDisk", func() {
@@ -79,8 +348,7 @@ var _ = Describe("Limits", func() {
 		)
 
 		Describe("CurrentDiskLimits", func() {
-			// PENDED: Until CurrentDiskLimits work with AUFS
-			PIt("reports the correct disk limit size of the container", func() {
+			It("reports exactly the disk limits the container was created with", func() {
 				limit, err := container.CurrentDiskLimits()
 				Expect(err).ToNot(HaveOccurred())
 				Expect(limit).To(Equal(garden.DiskLimits{
@@ -89,8 +357,94 @@ var _ = Describe("Limits", func() {
 					Scope:    limits.Disk.Scope,
 				}))
 			})
+
+			Context("when inode limits are set", func() {
+				BeforeEach(func() {
+					limits.Disk.InodeSoft = 1000
+					limits.Disk.InodeHard = 1000
+				})
+
+				It("reports the inode limits too", func() {
+					limit, err := container.CurrentDiskLimits()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(limit).To(Equal(limits.Disk))
+				})
+			})
 		})
 
+		Context("with an inode limit", func() {
+			BeforeEach(func() {
+				limits.Disk.InodeSoft = 500
+				limits.Disk.InodeHard = 500
+				limits.Disk.Scope = garden.DiskLimitScopeExclusive
+			})
+
+			It("allows creating files below the limit", func() {
+				Expect(createFiles(container, "/home/alice/few", 100)).To(Equal(0))
+			})
+
+			It("fails to create files beyond the limit", func() {
+				Expect(createFiles(container, "/home/alice/many", 1000)).ToNot(Equal(0))
+			})
+
+			It("reports the inodes used in the metrics", func() {
+				metrics, err := container.Metrics()
+				Expect(err).ToNot(HaveOccurred())
+				initialInodes := metrics.DiskStat.ExclusiveInodesUsed
+
+				Expect(createFiles(container, "/home/alice/counted", 100)).To(Equal(0))
+
+				Eventually(func() uint64 {
+					metrics, err := container.Metrics()
+					Expect(err).ToNot(HaveOccurred())
+					return metrics.DiskStat.ExclusiveInodesUsed
+				}).Should(BeNumerically("~", initialInodes+101, 10)) // 100 files and their directory
+
+				metrics, err = container.Metrics()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(metrics.DiskStat.TotalInodesUsed).To(BeNumerically(">", metrics.DiskStat.ExclusiveInodesUsed))
+			})
+
+			Context("when the inode limit is raised at runtime", func() {
+				JustBeforeEach(func() {
+					raised := limits.Disk
+					raised.InodeSoft = 5000
+					raised.InodeHard = 5000
+					Expect(container.LimitDisk(raised)).To(Succeed())
+				})
+
+				It("allows creating files beyond the old limit", func() {
+					Expect(createFiles(container, "/home/alice/many", 1000)).To(Equal(0))
+				})
+			})
+		})
+
+		DescribeTable("changing the byte limit at runtime",
+			func(scope garden.DiskLimitScope) {
+				newLimits := garden.DiskLimits{
+					ByteSoft: 20 * 1024 * 1024,
+					ByteHard: 20 * 1024 * 1024,
+					Scope:    scope,
+				}
+				Expect(container.LimitDisk(newLimits)).To(Succeed())
+
+				currentLimits, err := container.CurrentDiskLimits()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(currentLimits).To(Equal(newLimits))
+
+				dd, err := container.Run(garden.ProcessSpec{
+					User: "alice",
+					Path: "dd",
+					Args: []string{"if=/dev/zero", "of=/home/alice/too-big", "bs=1M", "count=30"},
+				}, garden.ProcessIO{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(dd.Wait()).ToNot(Equal(0))
+			},
+
+			Entry("with exclusive scope", garden.DiskLimitScopeExclusive),
+			Entry("with total scope", garden.DiskLimitScopeTotal),
+		)
+
 		Context("when the scope is total", func() {
 			BeforeEach(func() {
 				rootfs = "docker:///busybox#1.23"
@@ -344,3 +698,106 @@ var _ = Describe("Limits", func() {
 		})
 	})
 })
+
+// measureThroughput reads expectedBytes from the given port on the garden host
+// and returns the rate at which they arrived, in bytes per second.
+func measureThroughput(port uint32, expectedBytes int64) float64 {
+	gardenHostname := strings.Split(gardenHost, ":")[0]
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", gardenHostname, port), 5*time.Second)
+	Expect(err).ToNot(HaveOccurred())
+	defer conn.Close()
+
+	Expect(conn.SetReadDeadline(time.Now().Add(60 * time.Second))).To(Succeed())
+
+	startedAt := time.Now()
+	received, err := io.CopyN(ioutil.Discard, conn, expectedBytes)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(received).To(Equal(expectedBytes))
+
+	return float64(received) / time.Since(startedAt).Seconds()
+}
+
+// startCPULoad keeps every CPU the container can see busy calculating pi with
+// bc, so that containers running it compete for CPU time.
+func startCPULoad(container garden.Container) {
+	_, err := container.Run(garden.ProcessSpec{
+		User: "root",
+		Path: "bash",
+		Args: []string{"-c", `
+			for i in $(seq $(nproc)); do
+				while true; do echo "scale=1000; a(1)*4" | bc -l > /dev/null; done &
+			done
+			wait
+		`},
+	}, garden.ProcessIO{
+		Stdout: GinkgoWriter,
+		Stderr: GinkgoWriter,
+	})
+	Expect(err).ToNot(HaveOccurred())
+}
+
+// cpuUsageOver returns how much CPU time, as reported by Metrics(), each of the
+// containers used during the given period.
+func cpuUsageOver(period time.Duration, containers ...garden.Container) []uint64 {
+	cpuUsage := func() []uint64 {
+		usage := make([]uint64, len(containers))
+		for i, c := range containers {
+			metrics, err := c.Metrics()
+			Expect(err).ToNot(HaveOccurred())
+			usage[i] = metrics.CPUStat.Usage
+		}
+
+		return usage
+	}
+
+	before := cpuUsage()
+	time.Sleep(period)
+	after := cpuUsage()
+
+	for i := range after {
+		after[i] -= before[i]
+		Expect(after[i]).To(BeNumerically(">", 0))
+	}
+
+	return after
+}
+
+// allocateMemory runs a process in the container that allocates and touches
+// the given number of megabytes of anonymous memory, and returns its exit
+// status.
+func allocateMemory(container garden.Container, megabytes int) int {
+	process, err := container.Run(garden.ProcessSpec{
+		User: "alice",
+		Path: "perl",
+		Args: []string{"-e", fmt.Sprintf(`my $x = "a" x (%d * 1024 * 1024); exit 0`, megabytes)},
+	}, garden.ProcessIO{
+		Stdout: GinkgoWriter,
+		Stderr: GinkgoWriter,
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	exitStatus, err := process.Wait()
+	Expect(err).ToNot(HaveOccurred())
+
+	return exitStatus
+}
+
+// createFiles creates count empty files in a new directory in the
+// container, stopping at the first failure, and returns the exit status.
+func createFiles(container garden.Container, dir string, count int) int {
+	process, err := container.Run(garden.ProcessSpec{
+		User: "alice",
+		Path: "sh",
+		Args: []string{"-c", fmt.Sprintf(`mkdir -p %s && for i in $(seq %d); do touch %s/file-$i || exit 1; done`, dir, count, dir)},
+	}, garden.ProcessIO{
+		Stdout: GinkgoWriter,
+		Stderr: GinkgoWriter,
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	exitStatus, err := process.Wait()
+	Expect(err).ToNot(HaveOccurred())
+
+	return exitStatus
+}
@@ -0,0 +1,142 @@
+package garden_integration_tests_test
+
+import (
+	"os"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+// unconfinedSELinuxTypes are SELinux domains that are effectively unconfined.
+var unconfinedSELinuxTypes = []string{"unconfined_t", "spc_t", "kernel_t", "initrc_t"}
+
+// Most of what a container profile denies, such as mounting or writing to
+// /proc, is also denied by dropped capabilities or read-only mounts, so a probe
+// could not tell which of them did it. Reading /sys/firmware is the exception
+// these specs rely on.
+var _ = Describe("Linux security modules", func() {
+	var label securityLabel
+
+	BeforeEach(func() {
+		privilegedContainer = false
+	})
+
+	JustBeforeEach(func() {
+		var ok bool
+		label, ok = readSecurityLabel(container, "root")
+		if !ok {
+			Skip("the host has no LSM that labels processes")
+		}
+	})
+
+	It("confines processes in an unprivileged container", func() {
+		Expect(label.confined()).To(BeTrue(), "%s is not confined", label)
+	})
+
+	It("applies the configured profile", func() {
+		expected := os.Getenv("GARDEN_LSM_PROFILE")
+		if expected == "" {
+			Skip("GARDEN_LSM_PROFILE is not set")
+		}
+
+		Expect(label.value).To(HavePrefix(expected))
+	})
+
+	It("applies the same profile to processes run as a non-root user", func() {
+		aliceLabel, ok := readSecurityLabel(container, "alice")
+		Expect(ok).To(BeTrue())
+		Expect(aliceLabel).To(Equal(label))
+	})
+
+	It("does not let root read firmware data, which a read-only /sys still allows", func() {
+		if label.lsm != "apparmor" {
+			Skip("only AppArmor container profiles, derived from Docker's, are known to deny /sys/firmware")
+		}
+
+		// the directories are world-readable, so only the profile can refuse
+		// the listing; for the file, pick one that is world-readable too
+		output := gbytes.NewBuffer()
+		exitStatus := runInContainer(container, "root", `
+			ls /sys/firmware 2>&1 > /dev/null || exit 1
+			file=$(find /sys/firmware -type f -perm -0004 2>/dev/null | head -n1)
+			[ -n "$file" ] || exit 2
+			head -c1 "$file" 2>&1 > /dev/null
+		`, output)
+		if exitStatus == 2 {
+			Skip("the host has no world-readable files under /sys/firmware")
+		}
+
+		Expect(exitStatus).ToNot(Equal(0))
+		Expect(output).To(gbytes.Say("Permission denied"))
+	})
+
+	It("does not let root change its own confinement", func() {
+		transition := "changeprofile unconfined"
+		if label.lsm == "selinux" {
+			transition = "system_u:system_r:unconfined_t:s0"
+		}
+
+		Expect(runInContainer(container, "root", "echo -n '"+transition+"' > /proc/self/attr/current", GinkgoWriter)).ToNot(Equal(0))
+
+		after, ok := readSecurityLabel(container, "root")
+		Expect(ok).To(BeTrue())
+		Expect(after).To(Equal(label))
+	})
+})
+
+// securityLabel is the LSM context of a process, as read from
+// /proc/<pid>/attr/current.
+type securityLabel struct {
+	lsm   string // apparmor or selinux
+	value string
+}
+
+func (label securityLabel) String() string {
+	return label.lsm + " label " + label.value
+}
+
+func (label securityLabel) confined() bool {
+	switch label.lsm {
+	case "apparmor":
+		// e.g. "garden-default (enforce)"; complain mode only logs
+		return label.value != "unconfined" && strings.HasSuffix(label.value, "(enforce)")
+	case "selinux":
+		// e.g. "system_u:system_r:container_t:s0:c1,c2"
+		fields := strings.Split(label.value, ":")
+		if len(fields) < 3 {
+			return false
+		}
+
+		for _, unconfined := range unconfinedSELinuxTypes {
+			if fields[2] == unconfined {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// readSecurityLabel returns the label of a process run as user in the
+// container, and false if the host has no LSM that labels processes.
+func readSecurityLabel(container garden.Container, user string) (securityLabel, bool) {
+	stdout := gbytes.NewBuffer()
+	if runInContainer(container, user, "cat /proc/self/attr/current", stdout) != 0 {
+		return securityLabel{}, false
+	}
+
+	value := strings.TrimSpace(strings.TrimRight(string(stdout.Contents()), "\x00\n"))
+	switch {
+	case value == "":
+		return securityLabel{}, false
+	case strings.Count(value, ":") >= 3:
+		return securityLabel{lsm: "selinux", value: value}, true
+	default:
+		return securityLabel{lsm: "apparmor", value: value}, true
+	}
+}
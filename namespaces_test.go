@@ -0,0 +1,163 @@
+package garden_integration_tests_test
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var namespaceTypes = []string{"net", "uts", "ipc", "mnt", "pid", "user"}
+
+// initialNamespaceInodes are the fixed inode numbers the kernel gives the
+// host's own namespaces (PROC_*_INIT_INO). The host's net and mnt namespaces
+// have no fixed inode, so are only compared with sibling containers.
+var initialNamespaceInodes = map[string]string{
+	"ipc":  "4026531839",
+	"uts":  "4026531838",
+	"user": "4026531837",
+	"pid":  "4026531836",
+}
+
+var _ = Describe("Namespace isolation", func() {
+	var sibling garden.Container
+
+	BeforeEach(func() {
+		rootfs = "docker:///ubuntu"
+		privilegedContainer = false
+		sibling = nil
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		sibling, err = gardenClient.Create(garden.ContainerSpec{RootFSPath: rootfs})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		if sibling != nil {
+			Expect(gardenClient.Destroy(sibling.Handle())).To(Succeed())
+		}
+	})
+
+	It("puts the container in its own namespace of every type", func() {
+		namespaces := readNamespaces(container)
+
+		for _, nsType := range namespaceTypes {
+			Expect(namespaces).To(HaveKey(nsType))
+		}
+
+		for nsType, hostInode := range initialNamespaceInodes {
+			Expect(namespaces[nsType]).ToNot(Equal(hostInode), "%s namespace is shared with the host", nsType)
+		}
+	})
+
+	It("does not share any namespace with a sibling container", func() {
+		namespaces := readNamespaces(container)
+		siblingNamespaces := readNamespaces(sibling)
+
+		for _, nsType := range namespaceTypes {
+			Expect(namespaces[nsType]).ToNot(Equal(siblingNamespaces[nsType]), "%s namespace is shared with the sibling", nsType)
+		}
+	})
+
+	It("does not let SysV shared memory leak into a sibling container", func() {
+		stdout := gbytes.NewBuffer()
+		Expect(runInContainer(container, "root", "ipcmk -M 4096 && ipcs -m", stdout)).To(Equal(0))
+		Expect(stdout).To(gbytes.Say(`0x[0-9a-f]+`))
+
+		siblingStdout := gbytes.NewBuffer()
+		Expect(runInContainer(sibling, "root", "ipcs -m", siblingStdout)).To(Equal(0))
+		Expect(siblingStdout.Contents()).ToNot(MatchRegexp(`(?m)^0x[0-9a-f]+`))
+	})
+
+	Context("in a privileged container", func() {
+		// root in an unprivileged container lacks CAP_SYS_ADMIN, which
+		// sethostname(2) needs
+		BeforeEach(func() {
+			privilegedContainer = true
+		})
+
+		It("does not let a hostname change leak into a sibling container", func() {
+			Expect(runInContainer(container, "root", "hostname changed-by-test", GinkgoWriter)).To(Equal(0))
+
+			stdout := gbytes.NewBuffer()
+			Expect(runInContainer(container, "root", "hostname", stdout)).To(Equal(0))
+			Expect(stdout).To(gbytes.Say("changed-by-test"))
+
+			siblingStdout := gbytes.NewBuffer()
+			Expect(runInContainer(sibling, "root", "hostname", siblingStdout)).To(Equal(0))
+			Expect(siblingStdout).To(gbytes.Say(fmt.Sprintf("%s\n", sibling.Handle())))
+		})
+	})
+
+	It("does not show a container's processes to a sibling container", func() {
+		_, err := container.Run(garden.ProcessSpec{
+			User: "root",
+			Path: "sleep",
+			Args: []string{"424242"},
+		}, garden.ProcessIO{})
+		Expect(err).ToNot(HaveOccurred())
+
+		// the ubuntu image has no ps, so read every process's command line
+		siblingStdout := gbytes.NewBuffer()
+		Expect(runInContainer(sibling, "root", "cat /proc/[0-9]*/cmdline | tr '\\0' ' '", siblingStdout)).To(Equal(0))
+		Expect(string(siblingStdout.Contents())).ToNot(ContainSubstring("424242"))
+	})
+
+	It("does not show a container's files to a sibling container", func() {
+		Expect(runInContainer(container, "root", "touch /tmp/only-in-one-container", GinkgoWriter)).To(Equal(0))
+		Expect(runInContainer(sibling, "root", "test -e /tmp/only-in-one-container", GinkgoWriter)).ToNot(Equal(0))
+	})
+
+	It("gives each container its own network interfaces", func() {
+		info, err := container.Info()
+		Expect(err).ToNot(HaveOccurred())
+
+		siblingStdout := gbytes.NewBuffer()
+		Expect(runInContainer(sibling, "root", "cat /proc/net/fib_trie", siblingStdout)).To(Equal(0))
+		Expect(string(siblingStdout.Contents())).ToNot(ContainSubstring(info.ContainerIP))
+	})
+})
+
+// readNamespaces returns the inode number of each of the namespaces a process
+// in the container belongs to, keyed by namespace type.
+func readNamespaces(container garden.Container) map[string]string {
+	stdout := gbytes.NewBuffer()
+	script := ""
+	for _, nsType := range namespaceTypes {
+		script += fmt.Sprintf("readlink /proc/self/ns/%s; ", nsType)
+	}
+	Expect(runInContainer(container, "root", script, stdout)).To(Equal(0))
+
+	namespaces := map[string]string{}
+	for _, match := range regexp.MustCompile(`(\w+):\[(\d+)\]`).FindAllStringSubmatch(string(stdout.Contents()), -1) {
+		namespaces[match[1]] = match[2]
+	}
+
+	return namespaces
+}
+
+// runInContainer runs script with sh in the container and returns its exit
+// status.
+func runInContainer(container garden.Container, user, script string, stdout io.Writer) int {
+	process, err := container.Run(garden.ProcessSpec{
+		User: user,
+		Path: "sh",
+		Args: []string{"-c", strings.TrimSpace(script)},
+	}, garden.ProcessIO{
+		Stdout: stdout,
+		Stderr: GinkgoWriter,
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	exitStatus, err := process.Wait()
+	Expect(err).ToNot(HaveOccurred())
+
+	return exitStatus
+}
@@ -2,76 +2,563 @@ package garden_integration_tests_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudfoundry-incubator/garden"
 	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/config"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
 )
 
 var _ = Describe("Networking", func() {
-	It("can be contacted after a NetIn", func() {
-		process, err := container.Run(garden.ProcessSpec{
-			Path: "sh",
-			Args: []string{"-c", "echo hallo | nc -l -p 8080"},
+	Describe("NetIn", func() {
+		It("can be contacted after a NetIn", func() {
+			process, err := container.Run(garden.ProcessSpec{
+				Path: "sh",
+				Args: []string{"-c", "echo hallo | nc -l -p 8080"},
+				User: "root",
+			}, garden.ProcessIO{
+				Stdout: GinkgoWriter,
+				Stderr: GinkgoWriter,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			defer func() {
+				process.Signal(garden.SignalTerminate)
+				_, err := process.Wait()
+				Expect(err).NotTo(HaveOccurred())
+			}()
+
+			gardenHostname := strings.Split(gardenHost, ":")[0]
+
+			hostPort, _, err := container.NetIn(0, 8080)
+			Expect(err).ToNot(HaveOccurred())
+
+			waitForListener(container, "tcp", 8080)
+
+			nc, err := gexec.Start(exec.Command("nc", gardenHostname, fmt.Sprintf("%d", hostPort)), GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(nc).Should(gbytes.Say("hallo"))
+			Eventually(nc).Should(gexec.Exit(0))
+		})
+
+		It("maps to the requested host port", func() {
+			requestedPort := explicitHostPort(0)
+
+			hostPort, containerPort, err := container.NetIn(requestedPort, 8080)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hostPort).To(Equal(requestedPort))
+			Expect(containerPort).To(Equal(uint32(8080)))
+
+			_, err = container.Run(garden.ProcessSpec{
+				User: "root",
+				Path: "sh",
+				Args: []string{"-c", "while true; do echo hallo | nc -l -p 8080; done"},
+			}, garden.ProcessIO{
+				Stdout: GinkgoWriter,
+				Stderr: GinkgoWriter,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			waitForListener(container, "tcp", 8080)
+			Eventually(func() (string, error) { return readFromPort(requestedPort) }).Should(Equal("hallo\n"))
+		})
+
+		It("uses the host port as the container port when the container port is 0", func() {
+			hostPort, containerPort, err := container.NetIn(0, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hostPort).ToNot(BeZero())
+			Expect(containerPort).To(Equal(hostPort))
+		})
+
+		It("reports the mappings in the container's info", func() {
+			hostPort, containerPort, err := container.NetIn(0, 8080)
+			Expect(err).ToNot(HaveOccurred())
+
+			info, err := container.Info()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.MappedPorts).To(ContainElement(garden.PortMapping{
+				HostPort:      hostPort,
+				ContainerPort: containerPort,
+			}))
+		})
+
+		It("supports many concurrent mappings in one container", func() {
+			const mappings = 20
+
+			var mu sync.Mutex
+			mapped := []garden.PortMapping{}
+
+			err := forEachConcurrently(mappings, func(i int) error {
+				hostPort, containerPort, err := container.NetIn(0, uint32(8000+i))
+				if err != nil {
+					return err
+				}
+
+				mu.Lock()
+				mapped = append(mapped, garden.PortMapping{HostPort: hostPort, ContainerPort: containerPort})
+				mu.Unlock()
+
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			hostPorts := map[uint32]bool{}
+			for _, mapping := range mapped {
+				hostPorts[mapping.HostPort] = true
+			}
+			Expect(hostPorts).To(HaveLen(mappings))
+
+			info, err := container.Info()
+			Expect(err).ToNot(HaveOccurred())
+			for _, mapping := range mapped {
+				Expect(info.MappedPorts).To(ContainElement(mapping))
+			}
+		})
+
+		Context("with a second container", func() {
+			var otherContainer garden.Container
+
+			BeforeEach(func() {
+				otherContainer = nil
+			})
+
+			JustBeforeEach(func() {
+				var err error
+				otherContainer, err = gardenClient.Create(garden.ContainerSpec{RootFSPath: rootfs})
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				if otherContainer != nil {
+					Expect(gardenClient.Destroy(otherContainer.Handle())).To(Succeed())
+				}
+			})
+
+			It("does not hand out the same host port to both containers", func() {
+				hostPort, _, err := container.NetIn(0, 8080)
+				Expect(err).ToNot(HaveOccurred())
+
+				otherHostPort, _, err := otherContainer.NetIn(0, 8080)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(otherHostPort).ToNot(Equal(hostPort))
+			})
+
+			It("fails to map a host port already mapped by another container", func() {
+				requestedPort := explicitHostPort(1)
+
+				_, _, err := container.NetIn(requestedPort, 8080)
+				Expect(err).ToNot(HaveOccurred())
+
+				_, _, err = otherContainer.NetIn(requestedPort, 8080)
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("releases the host port when the container is destroyed", func() {
+				requestedPort := explicitHostPort(2)
+
+				_, _, err := otherContainer.NetIn(requestedPort, 8080)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(gardenClient.Destroy(otherContainer.Handle())).To(Succeed())
+				otherContainer = nil
+
+				hostPort, _, err := container.NetIn(requestedPort, 8080)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hostPort).To(Equal(requestedPort))
+			})
+		})
+	})
+
+	Describe("NetOut", func() {
+		var (
+			echoServer   garden.Container
+			echoServerIP string
+		)
+
+		BeforeEach(func() {
+			echoServer = nil
+		})
+
+		JustBeforeEach(func() {
+			echoServerIP = startEchoServer(&echoServer, garden.ContainerSpec{RootFSPath: rootfs})
+		})
+
+		AfterEach(func() {
+			if echoServer != nil {
+				Expect(gardenClient.Destroy(echoServer.Handle())).To(Succeed())
+			}
+		})
+
+		It("cannot access the echo server before a NetOut", func() {
+			Expect(checkConnection(container, garden.ProtocolTCP, echoServerIP, echoServerTCPPort)).ToNot(Succeed())
+		})
+
+		It("can access the echo server after a NetOut", func() {
+			err := container.NetOut(garden.NetOutRule{
+				Networks: []garden.IPRange{
+					garden.IPRangeFromIP(net.ParseIP(echoServerIP)),
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(checkConnection(container, garden.ProtocolTCP, echoServerIP, echoServerTCPPort)).To(Succeed())
+		})
+
+		It("cannot access the echo server after a NetOut for a different address", func() {
+			err := container.NetOut(garden.NetOutRule{
+				Networks: []garden.IPRange{
+					garden.IPRangeFromIP(net.ParseIP("10.255.255.254")),
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(checkConnection(container, garden.ProtocolTCP, echoServerIP, echoServerTCPPort)).ToNot(Succeed())
+		})
+
+		It("blocks every protocol before any rule is applied", func() {
+			for _, probe := range []connectionProbe{tcpProbe, otherTCPProbe, udpProbe, icmpProbe} {
+				Expect(checkConnection(container, probe.protocol, echoServerIP, probe.port)).ToNot(Succeed(), "%s", probe)
+			}
+		})
+
+		DescribeTable("applying a rule",
+			func(ruleFor func(ip net.IP) garden.NetOutRule, allowed, blocked []connectionProbe) {
+				Expect(container.NetOut(ruleFor(net.ParseIP(echoServerIP)))).To(Succeed())
+
+				for _, probe := range allowed {
+					Expect(checkConnection(container, probe.protocol, echoServerIP, probe.port)).To(Succeed(), "expected %s to be allowed", probe)
+				}
+
+				for _, probe := range blocked {
+					Expect(checkConnection(container, probe.protocol, echoServerIP, probe.port)).ToNot(Succeed(), "expected %s to be blocked", probe)
+				}
+			},
+
+			Entry("for all protocols", func(ip net.IP) garden.NetOutRule {
+				return garden.NetOutRule{
+					Protocol: garden.ProtocolAll,
+					Networks: []garden.IPRange{garden.IPRangeFromIP(ip)},
+				}
+			}, []connectionProbe{tcpProbe, otherTCPProbe, udpProbe, icmpProbe}, []connectionProbe{}),
+
+			Entry("for TCP", func(ip net.IP) garden.NetOutRule {
+				return garden.NetOutRule{
+					Protocol: garden.ProtocolTCP,
+					Networks: []garden.IPRange{garden.IPRangeFromIP(ip)},
+				}
+			}, []connectionProbe{tcpProbe, otherTCPProbe}, []connectionProbe{udpProbe, icmpProbe}),
+
+			Entry("for UDP", func(ip net.IP) garden.NetOutRule {
+				return garden.NetOutRule{
+					Protocol: garden.ProtocolUDP,
+					Networks: []garden.IPRange{garden.IPRangeFromIP(ip)},
+				}
+			}, []connectionProbe{udpProbe}, []connectionProbe{tcpProbe, icmpProbe}),
+
+			Entry("for ICMP", func(ip net.IP) garden.NetOutRule {
+				return garden.NetOutRule{
+					Protocol: garden.ProtocolICMP,
+					Networks: []garden.IPRange{garden.IPRangeFromIP(ip)},
+				}
+			}, []connectionProbe{icmpProbe}, []connectionProbe{tcpProbe, udpProbe}),
+
+			Entry("for a single TCP port", func(ip net.IP) garden.NetOutRule {
+				return garden.NetOutRule{
+					Protocol: garden.ProtocolTCP,
+					Networks: []garden.IPRange{garden.IPRangeFromIP(ip)},
+					Ports:    []garden.PortRange{garden.PortRangeFromPort(echoServerTCPPort)},
+				}
+			}, []connectionProbe{tcpProbe}, []connectionProbe{otherTCPProbe, udpProbe}),
+
+			Entry("for a TCP port range", func(ip net.IP) garden.NetOutRule {
+				return garden.NetOutRule{
+					Protocol: garden.ProtocolTCP,
+					Networks: []garden.IPRange{garden.IPRangeFromIP(ip)},
+					Ports:    []garden.PortRange{{Start: echoServerTCPPort - 5, End: echoServerTCPPort + 5}},
+				}
+			}, []connectionProbe{tcpProbe}, []connectionProbe{otherTCPProbe}),
+
+			Entry("for several TCP port ranges", func(ip net.IP) garden.NetOutRule {
+				return garden.NetOutRule{
+					Protocol: garden.ProtocolTCP,
+					Networks: []garden.IPRange{garden.IPRangeFromIP(ip)},
+					Ports: []garden.PortRange{
+						garden.PortRangeFromPort(echoServerTCPPort),
+						garden.PortRangeFromPort(echoServerOtherTCPPort),
+					},
+				}
+			}, []connectionProbe{tcpProbe, otherTCPProbe}, []connectionProbe{udpProbe}),
+
+			Entry("for a UDP port", func(ip net.IP) garden.NetOutRule {
+				return garden.NetOutRule{
+					Protocol: garden.ProtocolUDP,
+					Networks: []garden.IPRange{garden.IPRangeFromIP(ip)},
+					Ports:    []garden.PortRange{garden.PortRangeFromPort(echoServerUDPPort)},
+				}
+			}, []connectionProbe{udpProbe}, []connectionProbe{tcpProbe}),
+
+			Entry("for ICMP echo requests", func(ip net.IP) garden.NetOutRule {
+				return garden.NetOutRule{
+					Protocol: garden.ProtocolICMP,
+					Networks: []garden.IPRange{garden.IPRangeFromIP(ip)},
+					ICMPs: &garden.ICMPControl{
+						Type: 8, // echo request
+						Code: garden.ICMPControlCode(0),
+					},
+				}
+			}, []connectionProbe{icmpProbe}, []connectionProbe{tcpProbe}),
+
+			Entry("for ICMP types other than echo requests", func(ip net.IP) garden.NetOutRule {
+				return garden.NetOutRule{
+					Protocol: garden.ProtocolICMP,
+					Networks: []garden.IPRange{garden.IPRangeFromIP(ip)},
+					ICMPs: &garden.ICMPControl{
+						Type: 13, // timestamp request
+					},
+				}
+			}, []connectionProbe{}, []connectionProbe{icmpProbe}),
+
+			// the log goes to the host's kernel log, out of reach of this suite
+			Entry("with logging enabled, allowing the same traffic as without", func(ip net.IP) garden.NetOutRule {
+				return garden.NetOutRule{
+					Protocol: garden.ProtocolTCP,
+					Networks: []garden.IPRange{garden.IPRangeFromIP(ip)},
+					Log:      true,
+				}
+			}, []connectionProbe{tcpProbe}, []connectionProbe{udpProbe}),
+
+			Entry("for a network range containing the address", func(ip net.IP) garden.NetOutRule {
+				_, network, err := net.ParseCIDR(ip.String() + "/24")
+				Expect(err).ToNot(HaveOccurred())
+
+				return garden.NetOutRule{
+					Protocol: garden.ProtocolTCP,
+					Networks: []garden.IPRange{garden.IPRangeFromIPNet(network)},
+				}
+			}, []connectionProbe{tcpProbe}, []connectionProbe{udpProbe}),
+		)
+
+		Context("with a rule for multiple networks", func() {
+			var (
+				otherEchoServer   garden.Container
+				otherEchoServerIP string
+			)
+
+			BeforeEach(func() {
+				otherEchoServer = nil
+			})
+
+			JustBeforeEach(func() {
+				otherEchoServerIP = startEchoServer(&otherEchoServer, garden.ContainerSpec{RootFSPath: rootfs})
+			})
+
+			AfterEach(func() {
+				if otherEchoServer != nil {
+					Expect(gardenClient.Destroy(otherEchoServer.Handle())).To(Succeed())
+				}
+			})
+
+			It("allows every listed network", func() {
+				err := container.NetOut(garden.NetOutRule{
+					Protocol: garden.ProtocolTCP,
+					Networks: []garden.IPRange{
+						garden.IPRangeFromIP(net.ParseIP(echoServerIP)),
+						garden.IPRangeFromIP(net.ParseIP(otherEchoServerIP)),
+					},
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(checkConnection(container, garden.ProtocolTCP, echoServerIP, echoServerTCPPort)).To(Succeed())
+				Expect(checkConnection(container, garden.ProtocolTCP, otherEchoServerIP, echoServerTCPPort)).To(Succeed())
+			})
+
+			It("does not allow networks that are not listed", func() {
+				err := container.NetOut(garden.NetOutRule{
+					Protocol: garden.ProtocolTCP,
+					Networks: []garden.IPRange{
+						garden.IPRangeFromIP(net.ParseIP(echoServerIP)),
+					},
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(checkConnection(container, garden.ProtocolTCP, echoServerIP, echoServerTCPPort)).To(Succeed())
+				Expect(checkConnection(container, garden.ProtocolTCP, otherEchoServerIP, echoServerTCPPort)).ToNot(Succeed())
+			})
+		})
+	})
+})
+
+const (
+	echoServerTCPPort      = 8080
+	echoServerOtherTCPPort = 9090
+	echoServerUDPPort      = 8081
+)
+
+// startEchoServer creates a sibling container from spec running echo servers
+// on echoServerTCPPort, echoServerOtherTCPPort and echoServerUDPPort, so that
+// outbound networking can be tested without relying on the internet. The
+// container is stored in server as soon as it exists, so that an AfterEach
+// can destroy it even if starting the servers fails. It returns the IP.
+func startEchoServer(server *garden.Container, spec garden.ContainerSpec) string {
+	var err error
+	*server, err = gardenClient.Create(spec)
+	Expect(err).ToNot(HaveOccurred())
+
+	for _, listener := range []struct {
+		protocol string
+		port     int
+		ncFlags  string
+	}{
+		{"tcp", echoServerTCPPort, "-l"},
+		{"tcp", echoServerOtherTCPPort, "-l"},
+		{"udp", echoServerUDPPort, "-u -l"},
+	} {
+		_, err = (*server).Run(garden.ProcessSpec{
 			User: "root",
+			Path: "sh",
+			Args: []string{"-c", fmt.Sprintf("while true; do nc %s -p %d -e cat; done", listener.ncFlags, listener.port)},
 		}, garden.ProcessIO{
 			Stdout: GinkgoWriter,
 			Stderr: GinkgoWriter,
 		})
 		Expect(err).ToNot(HaveOccurred())
 
-		defer func() {
-			process.Signal(garden.SignalTerminate)
-			_, err := process.Wait()
-			Expect(err).NotTo(HaveOccurred())
-		}()
+		waitForListener(*server, listener.protocol, listener.port)
+	}
 
-		gardenHostname := strings.Split(gardenHost, ":")[0]
+	info, err := (*server).Info()
+	Expect(err).ToNot(HaveOccurred())
 
-		hostPort, _, err := container.NetIn(0, 8080)
-		Expect(err).ToNot(HaveOccurred())
+	return info.ContainerIP
+}
 
-		// Allow nc time to start running.
-		time.Sleep(2 * time.Second)
+// waitForListener waits until something in the container is listening on
+// the given port.
+func waitForListener(container garden.Container, protocol string, port int) {
+	flag := "-tln"
+	if protocol == "udp" {
+		flag = "-uln"
+	}
 
-		nc, err := gexec.Start(exec.Command("nc", gardenHostname, fmt.Sprintf("%d", hostPort)), GinkgoWriter, GinkgoWriter)
-		Expect(err).ToNot(HaveOccurred())
-		Eventually(nc).Should(gbytes.Say("hallo"))
-		Eventually(nc).Should(gexec.Exit(0))
-	})
+	Eventually(func() (int, error) {
+		process, err := container.Run(garden.ProcessSpec{
+			User: "root",
+			Path: "sh",
+			Args: []string{"-c", fmt.Sprintf("netstat %s | grep -q ':%d '", flag, port)},
+		}, garden.ProcessIO{
+			Stdout: GinkgoWriter,
+			Stderr: GinkgoWriter,
+		})
+		if err != nil {
+			return -1, err
+		}
 
-	It("can access a remote address after a NetOut", func() {
-		ips, err := net.LookupIP("www.example.com")
-		Expect(err).ToNot(HaveOccurred())
-		Expect(ips).ToNot(BeEmpty())
-		externalIP := ips[0]
+		return process.Wait()
+	}).Should(Equal(0), "nothing listening on %s port %d", protocol, port)
+}
 
-		err = container.NetOut(garden.NetOutRule{
-			Networks: []garden.IPRange{
-				garden.IPRangeFromIP(externalIP),
-			},
-		})
+// defaultHostPortBase is just below garden-linux's default NetIn port pool,
+// which starts at 61001.
+const defaultHostPortBase = 60000
+
+// explicitHostPort returns a host port for specs that need to request a
+// specific one, offset by the parallel node so that nodes do not collide.
+// Ports start at $GARDEN_HOST_PORT_BASE, which must leave room for 10 ports
+// per node outside of the server's NetIn port pool.
+func explicitHostPort(offset int) uint32 {
+	base := defaultHostPortBase
+	if configured := os.Getenv("GARDEN_HOST_PORT_BASE"); configured != "" {
+		var err error
+		base, err = strconv.Atoi(configured)
 		Expect(err).ToNot(HaveOccurred())
+	}
 
-		Expect(checkInternet(container, externalIP)).To(Succeed())
-	})
-})
+	return uint32(base + 10*config.GinkgoConfig.ParallelNode + offset)
+}
 
-func checkInternet(container garden.Container, externalIP net.IP) error {
-	return checkConnection(container, externalIP.String(), 80)
+// readFromPort connects to the given port on the garden host and returns
+// whatever is sent back.
+func readFromPort(port uint32) (string, error) {
+	gardenHostname := strings.Split(gardenHost, ":")[0]
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", gardenHostname, port), time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	data, err := ioutil.ReadAll(conn)
+	if len(data) > 0 {
+		// nc may hold the connection open after writing; what it sent is enough
+		return string(data), nil
+	}
+
+	return "", err
+}
+
+type connectionProbe struct {
+	protocol garden.Protocol
+	port     int
 }
 
-func checkConnection(container garden.Container, ip string, port int) error {
+var (
+	tcpProbe      = connectionProbe{garden.ProtocolTCP, echoServerTCPPort}
+	otherTCPProbe = connectionProbe{garden.ProtocolTCP, echoServerOtherTCPPort}
+	udpProbe      = connectionProbe{garden.ProtocolUDP, echoServerUDPPort}
+	icmpProbe     = connectionProbe{garden.ProtocolICMP, 0}
+)
+
+func (p connectionProbe) String() string {
+	switch p.protocol {
+	case garden.ProtocolTCP:
+		return fmt.Sprintf("tcp/%d", p.port)
+	case garden.ProtocolUDP:
+		return fmt.Sprintf("udp/%d", p.port)
+	case garden.ProtocolICMP:
+		return "icmp"
+	default:
+		return fmt.Sprintf("protocol %d/%d", p.protocol, p.port)
+	}
+}
+
+// checkConnection tries to reach ip from inside the container. TCP only
+// needs the connection to be accepted; UDP needs the echo server's reply,
+// since sending a datagram always succeeds; ICMP pings the address and
+// ignores the port.
+func checkConnection(container garden.Container, protocol garden.Protocol, ip string, port int) error {
+	// ping needs CAP_NET_RAW, which only root has in a container
+	user := "alice"
+
+	var script string
+	switch protocol {
+	case garden.ProtocolTCP:
+		script = fmt.Sprintf("echo hello | nc -w1 %s %d", ip, port)
+	case garden.ProtocolUDP:
+		script = fmt.Sprintf("echo hello | nc -u -w1 %s %d | grep -q hello", ip, port)
+	case garden.ProtocolICMP:
+		script = fmt.Sprintf("ping -c1 -W1 %s", ip)
+		user = "root"
+	default:
+		return fmt.Errorf("cannot check connections for protocol %d", protocol)
+	}
+
 	process, err := container.Run(garden.ProcessSpec{
-		User: "alice",
+		User: user,
 		Path: "sh",
-		Args: []string{"-c", fmt.Sprintf("echo hello | nc -w1 %s %d", ip, port)},
+		Args: []string{"-c", script},
 	}, garden.ProcessIO{Stdout: GinkgoWriter, Stderr: GinkgoWriter})
 	if err != nil {
 		return err
@@ -0,0 +1,217 @@
+package garden_integration_tests_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/config"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Properties", func() {
+	// unique makes property values distinct for each spec, so that filters do
+	// not match containers created by other specs running in parallel
+	var unique func(value string) string
+
+	BeforeEach(func() {
+		suffix := fmt.Sprintf("%d-%d", config.GinkgoConfig.ParallelNode, time.Now().UnixNano())
+		unique = func(value string) string {
+			return value + "-" + suffix
+		}
+
+		properties = garden.Properties{
+			"foo": unique("bar"),
+			"a":   unique("b"),
+		}
+	})
+
+	Describe("filtering containers by property", func() {
+		var otherHandles []string
+
+		BeforeEach(func() {
+			otherHandles = []string{}
+		})
+
+		JustBeforeEach(func() {
+			for _, props := range []garden.Properties{
+				{"foo": unique("bar"), "a": unique("c")},
+				{"foo": unique("baz"), "a": unique("b")},
+			} {
+				other, err := gardenClient.Create(garden.ContainerSpec{Properties: props})
+				Expect(err).ToNot(HaveOccurred())
+				otherHandles = append(otherHandles, other.Handle())
+			}
+		})
+
+		AfterEach(func() {
+			Expect(destroyContainers(otherHandles)).To(Succeed())
+		})
+
+		It("only returns containers matching every key in the filter", func() {
+			containers, err := gardenClient.Containers(garden.Properties{"foo": unique("bar"), "a": unique("b")})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(containers).To(HaveLen(1))
+			Expect(containers[0].Handle()).To(Equal(container.Handle()))
+		})
+
+		It("returns every container matching a subset of the keys", func() {
+			containers, err := gardenClient.Containers(garden.Properties{"foo": unique("bar")})
+			Expect(err).ToNot(HaveOccurred())
+
+			handles := []string{}
+			for _, c := range containers {
+				handles = append(handles, c.Handle())
+			}
+
+			Expect(handles).To(ConsistOf(container.Handle(), otherHandles[0]))
+		})
+
+		It("returns nothing when one of the keys does not match", func() {
+			containers, err := gardenClient.Containers(garden.Properties{"foo": unique("bar"), "a": "nope"})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(containers).To(BeEmpty())
+		})
+	})
+
+	Describe("values", func() {
+		It("can store an empty string", func() {
+			Expect(container.SetProperty("empty", "")).To(Succeed())
+
+			value, err := container.Property("empty")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal(""))
+
+			props, err := container.Properties()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(props).To(HaveKeyWithValue("empty", ""))
+		})
+
+		It("can store a large value", func() {
+			large := strings.Repeat("x", 64*1024)
+			Expect(container.SetProperty("large", large)).To(Succeed())
+
+			value, err := container.Property("large")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal(large))
+		})
+
+		It("can store values with special characters", func() {
+			value := "spaces, \"quotes\", new\nlines and ünïcödé"
+			Expect(container.SetProperty("special", value)).To(Succeed())
+
+			props, err := container.Properties()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(props).To(HaveKeyWithValue("special", value))
+		})
+	})
+
+	Describe("keys", func() {
+		keys := []string{
+			"with.dots",
+			"with-dashes_and_underscores",
+			"with:colons",
+			"with spaces",
+			"ünïcödé",
+		}
+
+		for _, key := range keys {
+			key := key
+
+			It(fmt.Sprintf("round-trips the key %q", key), func() {
+				Expect(container.SetProperty(key, "value")).To(Succeed())
+
+				value, err := container.Property(key)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(value).To(Equal("value"))
+
+				props, err := container.Properties()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(props).To(HaveKeyWithValue(key, "value"))
+
+				Expect(container.RemoveProperty(key)).To(Succeed())
+
+				props, err = container.Properties()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(props).ToNot(HaveKey(key))
+			})
+		}
+	})
+
+	// The garden client turns every server error into a plain error carrying
+	// the server's message, so there is no error type to assert on.
+	Describe("missing keys", func() {
+		It("returns an error naming the key from Property", func() {
+			_, err := container.Property("does-not-exist")
+			Expect(err).To(MatchError(ContainSubstring("property does not exist")))
+			Expect(err).To(MatchError(ContainSubstring("does-not-exist")))
+		})
+
+		It("returns an error naming the key from RemoveProperty", func() {
+			err := container.RemoveProperty("does-not-exist")
+			Expect(err).To(MatchError(ContainSubstring("property does not exist")))
+			Expect(err).To(MatchError(ContainSubstring("does-not-exist")))
+		})
+	})
+
+	Describe("concurrent updates", func() {
+		It("applies every SetProperty and RemoveProperty", func() {
+			wg := sync.WaitGroup{}
+
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+
+				go func(index int) {
+					defer wg.Done()
+					defer GinkgoRecover()
+
+					key := fmt.Sprintf("key-%d", index)
+					Expect(container.SetProperty(key, fmt.Sprintf("value-%d", index))).To(Succeed())
+
+					if index%2 == 1 {
+						Expect(container.RemoveProperty(key)).To(Succeed())
+					}
+				}(i)
+			}
+
+			wg.Wait()
+
+			expected := garden.Properties{"foo": unique("bar"), "a": unique("b")}
+			for i := 0; i < 20; i += 2 {
+				expected[fmt.Sprintf("key-%d", i)] = fmt.Sprintf("value-%d", i)
+			}
+
+			props, err := container.Properties()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(props).To(Equal(expected))
+		})
+	})
+
+	Describe("across a server restart", func() {
+		BeforeEach(func() {
+			skipUnlessRestartable()
+		})
+
+		It("keeps the container's properties", func() {
+			Expect(container.SetProperty("set-after-create", "yes")).To(Succeed())
+
+			restartGarden()
+
+			restored, err := gardenClient.Lookup(container.Handle())
+			Expect(err).ToNot(HaveOccurred())
+
+			props, err := restored.Properties()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(props).To(Equal(garden.Properties{
+				"foo":              unique("bar"),
+				"a":                unique("b"),
+				"set-after-create": "yes",
+			}))
+		})
+	})
+})
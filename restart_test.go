@@ -0,0 +1,135 @@
+package garden_integration_tests_test
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Server restart", func() {
+	var (
+		infoBeforeRestart garden.ContainerInfo
+		hostPort          uint32
+		process           garden.Process
+	)
+
+	BeforeEach(func() {
+		skipUnlessRestartable()
+
+		properties = garden.Properties{"restart": "fixture"}
+		limits = garden.Limits{
+			Memory: garden.MemoryLimits{LimitInBytes: 64 * 1024 * 1024},
+			CPU:    garden.CPULimits{LimitInShares: 50},
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+
+		process, err = container.Run(garden.ProcessSpec{
+			User: "root",
+			Path: "sh",
+			Args: []string{"-c", "while true; do echo hallo | nc -l -p 8080; done"},
+		}, garden.ProcessIO{
+			Stdout: GinkgoWriter,
+			Stderr: GinkgoWriter,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		hostPort, _, err = container.NetIn(0, 8080)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() (string, error) { return readFromPort(hostPort) }).Should(Equal("hallo\n"))
+
+		infoBeforeRestart, err = container.Info()
+		Expect(err).ToNot(HaveOccurred())
+
+		restartGarden()
+	})
+
+	// Restarting is slow and disruptive, so every check shares one restart.
+	It("preserves the container's state and keeps it usable", func() {
+		By("still listing the container", func() {
+			Expect(getContainerHandles()).To(ContainElement(container.Handle()))
+
+			containers, err := gardenClient.Containers(garden.Properties{"restart": "fixture"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(containers).To(HaveLen(1))
+		})
+
+		By("preserving the container's info", func() {
+			info, err := container.Info()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(info.State).To(Equal(infoBeforeRestart.State))
+			Expect(info.HostIP).To(Equal(infoBeforeRestart.HostIP))
+			Expect(info.ContainerIP).To(Equal(infoBeforeRestart.ContainerIP))
+			Expect(info.ExternalIP).To(Equal(infoBeforeRestart.ExternalIP))
+			Expect(info.ContainerPath).To(Equal(infoBeforeRestart.ContainerPath))
+			Expect(info.Properties).To(Equal(infoBeforeRestart.Properties))
+			Expect(info.MappedPorts).To(Equal(infoBeforeRestart.MappedPorts))
+		})
+
+		By("preserving the container's limits", func() {
+			memoryLimits, err := container.CurrentMemoryLimits()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(memoryLimits).To(Equal(limits.Memory))
+
+			cpuLimits, err := container.CurrentCPULimits()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cpuLimits).To(Equal(limits.CPU))
+		})
+
+		By("forwarding the NetIn port", func() {
+			Eventually(func() (string, error) { return readFromPort(hostPort) }, "10s").Should(Equal("hallo\n"))
+		})
+
+		By("running processes in the container", func() {
+			stdout := gbytes.NewBuffer()
+			process, err := container.Run(garden.ProcessSpec{
+				User: "alice",
+				Path: "echo",
+				Args: []string{"still here"},
+			}, garden.ProcessIO{
+				Stdout: stdout,
+				Stderr: GinkgoWriter,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(process.Wait()).To(Equal(0))
+			Expect(stdout).To(gbytes.Say("still here"))
+		})
+
+		By("either re-attaching to the running process or reporting it as unknown", func() {
+			type attachResult struct {
+				process garden.Process
+				err     error
+			}
+
+			attaching := make(chan attachResult, 1)
+			go func() {
+				attached, err := container.Attach(process.ID(), garden.ProcessIO{
+					Stdout: GinkgoWriter,
+					Stderr: GinkgoWriter,
+				})
+				attaching <- attachResult{attached, err}
+			}()
+
+			var result attachResult
+			Eventually(attaching, "10s").Should(Receive(&result))
+
+			if result.err != nil {
+				fmt.Fprintf(GinkgoWriter, "process %d was lost across the restart: %s\n", process.ID(), result.err)
+				Expect(result.err).To(MatchError(MatchRegexp(`unknown[ _]process`)))
+				return
+			}
+
+			Expect(result.process.ID()).To(Equal(process.ID()))
+			Expect(result.process.Signal(garden.SignalKill)).To(Succeed())
+			Expect(result.process.Wait()).ToNot(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,98 @@
+package garden_integration_tests_test
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+// unprivilegedSyscallProfile is what syscall-probe is expected to report in an
+// unprivileged container, see images/syscall-probe. It follows Docker's default
+// seccomp profile, which garden-runc's is derived from. Not every entry is
+// capability-gated: keyctl is denied because kernel keyrings are not
+// namespaced, so a backend that only drops capabilities will allow it.
+var unprivilegedSyscallProfile = map[string]string{
+	"mount":        "denied",
+	"kexec_load":   "denied",
+	"reboot":       "denied",
+	"ptrace":       "denied",
+	"keyctl":       "denied",
+	"bpf":          "denied",
+	"unshare_user": "denied",
+}
+
+var _ = Describe("Syscall filtering", func() {
+	BeforeEach(func() {
+		rootfs = os.Getenv("GARDEN_SYSCALL_PROBE_ROOTFS")
+		if rootfs == "" {
+			Skip("GARDEN_SYSCALL_PROBE_ROOTFS is not set")
+		}
+	})
+
+	Context("in an unprivileged container", func() {
+		BeforeEach(func() {
+			privilegedContainer = false
+		})
+
+		for _, user := range []string{"root", "alice"} {
+			user := user
+
+			It(fmt.Sprintf("denies dangerous syscalls made by %s", user), func() {
+				Expect(syscallProfileDrift(probeSyscalls(container, user), unprivilegedSyscallProfile)).To(BeEmpty())
+			})
+		}
+	})
+})
+
+// probeSyscalls runs syscall-probe in the container and returns whether each
+// syscall was allowed or denied.
+func probeSyscalls(container garden.Container, user string) map[string]string {
+	stdout := gbytes.NewBuffer()
+	process, err := container.Run(garden.ProcessSpec{
+		User: user,
+		Path: "/usr/bin/syscall-probe",
+	}, garden.ProcessIO{
+		Stdout: stdout,
+		Stderr: GinkgoWriter,
+	})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(process.Wait()).To(Equal(0))
+
+	results := map[string]string{}
+	for _, match := range regexp.MustCompile(`(?m)^(\w+): (allowed|denied)`).FindAllStringSubmatch(string(stdout.Contents()), -1) {
+		results[match[1]] = match[2]
+	}
+
+	return results
+}
+
+// syscallProfileDrift lists the syscalls syscall-probe reported differently
+// from the expected profile, including ones only one side knows about.
+func syscallProfileDrift(results, expected map[string]string) []string {
+	drift := []string{}
+	for name, want := range expected {
+		got, ok := results[name]
+		if !ok {
+			got = "not probed"
+		}
+
+		if got != want {
+			drift = append(drift, fmt.Sprintf("%s: expected %s, got %s", name, want, got))
+		}
+	}
+
+	for name, got := range results {
+		if _, ok := expected[name]; !ok {
+			drift = append(drift, fmt.Sprintf("%s: not in the expected profile, got %s", name, got))
+		}
+	}
+
+	sort.Strings(drift)
+	return drift
+}
@@ -1,7 +1,10 @@
 package garden_integration_tests_test
 
 import (
+	"fmt"
 	"io"
+	"io/ioutil"
+	"path/filepath"
 	"strings"
 
 	"github.com/cloudfoundry-incubator/garden"
@@ -225,6 +228,86 @@ var _ = Describe("Security", func() {
 		})
 	})
 
+	Describe("Devices", func() {
+		itDeniesDevicesOutsideTheWhitelist := func() {
+			for _, device := range []struct {
+				name, kind   string
+				major, minor int
+			}{
+				{"sda", "b", 8, 0},
+				{"mem", "c", 1, 1},
+				{"kmsg", "c", 1, 11},
+			} {
+				device := device
+
+				It(fmt.Sprintf("cannot open a %s device node it creates", device.name), func() {
+					// being refused the mknod is as good as being refused the open
+					path := "/tmp/" + device.name
+					if runInContainer(container, "root", fmt.Sprintf("mknod %s %s %d %d", path, device.kind, device.major, device.minor), GinkgoWriter) == 0 {
+						expectOpenDenied(container, path)
+					}
+				})
+
+				It(fmt.Sprintf("cannot open /dev/%s", device.name), func() {
+					path := "/dev/" + device.name
+					if runInContainer(container, "root", "[ -e "+path+" ]", GinkgoWriter) == 0 {
+						expectOpenDenied(container, path)
+					}
+				})
+			}
+		}
+
+		itAllowsTheStandardDevices := func() {
+			It("can write to /dev/null", func() {
+				Expect(runInContainer(container, "root", "echo hello > /dev/null", GinkgoWriter)).To(Equal(0))
+			})
+
+			It("can read from /dev/zero", func() {
+				Expect(runInContainer(container, "root", "head -c1 /dev/zero > /dev/null", GinkgoWriter)).To(Equal(0))
+			})
+
+			It("can read from /dev/urandom", func() {
+				Expect(runInContainer(container, "root", "head -c1 /dev/urandom > /dev/null", GinkgoWriter)).To(Equal(0))
+			})
+
+			It("can write to /dev/tty when it has a terminal", func() {
+				process, err := container.Run(garden.ProcessSpec{
+					User: "root",
+					Path: "sh",
+					Args: []string{"-c", "echo hello > /dev/tty"},
+					TTY:  &garden.TTYSpec{},
+				}, garden.ProcessIO{
+					Stdout: GinkgoWriter,
+					Stderr: GinkgoWriter,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(process.Wait()).To(Equal(0))
+			})
+		}
+
+		Context("in an unprivileged container", func() {
+			BeforeEach(func() {
+				privilegedContainer = false
+			})
+
+			itDeniesDevicesOutsideTheWhitelist()
+			itAllowsTheStandardDevices()
+		})
+
+		Context("in a privileged container", func() {
+			BeforeEach(func() {
+				privilegedContainer = true
+			})
+
+			itDeniesDevicesOutsideTheWhitelist()
+			itAllowsTheStandardDevices()
+
+			It("can open /dev/fuse if it is present", func() {
+				Expect(runInContainer(container, "root", "test -e /dev/fuse || exit 0; exec 3<>/dev/fuse", GinkgoWriter)).To(Equal(0))
+			})
+		})
+	})
+
 	Describe("Users and groups", func() {
 		It("maintains setuid permissions in unprivileged containers", func() {
 			stdout := gbytes.NewBuffer()
@@ -482,6 +565,87 @@ var _ = Describe("Security", func() {
 			Expect(process.Wait()).ToNot(Equal(0))
 		})
 
+		Describe("known container escape techniques", func() {
+			probes := escapeProbes()
+
+			It("has escape probes to run", func() {
+				Expect(probes).ToNot(BeEmpty())
+			})
+
+			for _, probe := range probes {
+				probe := probe
+
+				It(fmt.Sprintf("blocks the %s escape", probe.name), func() {
+					Expect(runInContainer(container, "root", probe.script, GinkgoWriter)).To(Equal(0), "see %s", probe.path)
+				})
+			}
+
+			It("blocks a symlink race on the StreamIn destination", func() {
+				// alice keeps swapping her own directory for a link to /root, which
+				// only root may write to
+				racer, err := container.Run(garden.ProcessSpec{
+					User: "alice",
+					Path: "sh",
+					Args: []string{"-c", "cd /home/alice; while true; do rm -rf target; mkdir target; rm -rf target; ln -s /root target; done"},
+				}, garden.ProcessIO{
+					Stdout: GinkgoWriter,
+					Stderr: GinkgoWriter,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				for i := 0; i < 50; i++ {
+					// most attempts fail because the destination is missing or
+					// is the link, which is fine; only the end result matters
+					container.StreamIn(garden.StreamInSpec{
+						User:      "alice",
+						Path:      "/home/alice/target",
+						TarStream: tarStream(tarFile("streamed-through-symlink", "escaped")),
+					})
+				}
+
+				Expect(racer.Signal(garden.SignalKill)).To(Succeed())
+				Expect(runInContainer(container, "root", "test ! -e /root/streamed-through-symlink", GinkgoWriter)).To(Equal(0))
+			})
+
+			It("blocks reopening the runtime's binary for writing through /proc/<pid>/exe", func() {
+				// CVE-2019-5736: hold on to the exe of a process the runtime starts
+				// in the container from a binary outside it, and reopen that for
+				// writing once the process has exec'd or exited. The append writes
+				// nothing, so even a successful reopen leaves the binary intact.
+				watcher, err := container.Run(garden.ProcessSpec{
+					User: "root",
+					Path: "sh",
+					Args: []string{"-c", `
+						while true; do
+							for exe in /proc/[0-9]*/exe; do
+								target=$(readlink "$exe" 2>/dev/null) || continue
+								[ -e "$target" ] && continue
+
+								(
+									exec 3< "$exe"
+									while [ "$(readlink "$exe" 2>/dev/null)" = "$target" ]; do :; done
+									if (: >> /proc/self/fd/3); then
+										echo "$target" > /tmp/reopened-runtime-binary
+									fi
+								) 2>/dev/null
+							done
+						done
+					`},
+				}, garden.ProcessIO{
+					Stdout: GinkgoWriter,
+					Stderr: GinkgoWriter,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				for i := 0; i < 20; i++ {
+					Expect(runInContainer(container, "root", "true", GinkgoWriter)).To(Equal(0))
+				}
+
+				Expect(watcher.Signal(garden.SignalKill)).To(Succeed())
+				Expect(runInContainer(container, "root", "test ! -e /tmp/reopened-runtime-binary", GinkgoWriter)).To(Equal(0))
+			})
+		})
+
 		It("can write to files in the /root directory", func() {
 			process, err := container.Run(garden.ProcessSpec{
 				User: "root",
@@ -700,3 +864,42 @@ var _ = Describe("Security", func() {
 		})
 	})
 })
+
+type escapeProbe struct {
+	name   string
+	path   string
+	script string
+}
+
+// escapeProbes loads every script in the escapes directory. It runs while the
+// spec tree is built, so dropping in a new script adds a new spec.
+func escapeProbes() []escapeProbe {
+	paths, err := filepath.Glob(filepath.Join("escapes", "*.sh"))
+	if err != nil {
+		panic(err)
+	}
+
+	probes := []escapeProbe{}
+	for _, path := range paths {
+		script, err := ioutil.ReadFile(path)
+		if err != nil {
+			panic(err)
+		}
+
+		probes = append(probes, escapeProbe{
+			name:   strings.TrimSuffix(filepath.Base(path), ".sh"),
+			path:   path,
+			script: string(script),
+		})
+	}
+
+	return probes
+}
+
+// expectOpenDenied checks that root in the container cannot read the device
+// node at path because the devices cgroup refuses to open it.
+func expectOpenDenied(container garden.Container, path string) {
+	output := gbytes.NewBuffer()
+	Expect(runInContainer(container, "root", "head -c1 "+path+" 2>&1 > /dev/null", output)).ToNot(Equal(0))
+	Expect(output).To(gbytes.Say("Operation not permitted"))
+}
@@ -0,0 +1,248 @@
+package garden_integration_tests_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+const (
+	nobodyID = 65534
+	largeID  = 700000 // see user_test.go
+
+	// identityMapSize is the size of the map the kernel gives namespaces that
+	// share the host's ids, i.e. every id but the invalid (uid_t)-1
+	identityMapSize = 4294967295
+)
+
+var _ = Describe("User namespace mappings", func() {
+	Context("in an unprivileged container", func() {
+		BeforeEach(func() {
+			privilegedContainer = false
+		})
+
+		for _, kind := range []string{"uid", "gid"} {
+			kind := kind
+
+			Describe(fmt.Sprintf("/proc/self/%s_map", kind), func() {
+				var mappings idMap
+
+				JustBeforeEach(func() {
+					mappings = readIDMap(container, kind)
+				})
+
+				It("maps container root to an unprivileged host id", func() {
+					hostID, ok := mappings.hostID(0)
+					Expect(ok).To(BeTrue(), "container root is not mapped")
+					Expect(hostID).ToNot(BeZero())
+				})
+
+				It("never maps to host root", func() {
+					for _, mapping := range mappings {
+						Expect(mapping.contains(0)).To(BeFalse(), "%+v maps to host root", mapping)
+					}
+				})
+
+				It("maps the ids of alice, nobody and the large 700000 user", func() {
+					flag := "-u"
+					if kind == "gid" {
+						flag = "-g"
+					}
+
+					Expect(readID(container, "nobody", flag)).To(Equal(uint64(nobodyID)))
+
+					for _, id := range []uint64{readID(container, "alice", flag), nobodyID, largeID} {
+						_, ok := mappings.hostID(id)
+						Expect(ok).To(BeTrue(), "%s %d is not mapped", kind, id)
+					}
+				})
+
+				It("maps every id from 0 through the large 700000 user without gaps", func() {
+					next := uint64(0)
+					for next <= largeID {
+						mapping, ok := mappings.containing(next)
+						Expect(ok).To(BeTrue(), "%s %d is not mapped", kind, next)
+						next = mapping.containerID + mapping.size
+					}
+				})
+
+				It("only maps to valid host ids", func() {
+					for _, mapping := range mappings {
+						Expect(mapping.size).ToNot(BeZero(), "%+v is empty", mapping)
+						Expect(mapping.hostID+mapping.size).To(BeNumerically("<=", uint64(identityMapSize)), "%+v reaches the invalid id (uid_t)-1", mapping)
+					}
+				})
+
+				It("does not map two container ids to the same host id", func() {
+					for i, mapping := range mappings {
+						for _, other := range mappings[i+1:] {
+							overlaps := mapping.hostID < other.hostID+other.size && other.hostID < mapping.hostID+mapping.size
+							Expect(overlaps).To(BeFalse(), "%+v and %+v overlap on the host", mapping, other)
+						}
+					}
+				})
+			})
+		}
+
+		Context("when the backend runs on this host", func() {
+			var (
+				uidMap, gidMap idMap
+				containerPath  string
+			)
+
+			JustBeforeEach(func() {
+				info, err := container.Info()
+				Expect(err).ToNot(HaveOccurred())
+
+				containerPath = info.ContainerPath
+				if _, err := os.Stat(containerPath); err != nil {
+					Skip("the container's depot directory is not on this host")
+				}
+
+				uidMap = readIDMap(container, "uid")
+				gidMap = readIDMap(container, "gid")
+
+				Expect(runInContainer(container, "root", fmt.Sprintf(
+					"addgroup -g %d bob && adduser -u %d -G bob -D bob", largeID, largeID,
+				), GinkgoWriter)).To(Equal(0))
+			})
+
+			for _, owner := range []string{"root", "alice", "bob"} {
+				owner := owner
+
+				It(fmt.Sprintf("gives files created by %s the mapped host ids", owner), func() {
+					name := fmt.Sprintf("created-by-%s-%s", owner, container.Handle())
+					Expect(runInContainer(container, owner, "touch /tmp/"+name, GinkgoWriter)).To(Equal(0))
+
+					stat, err := findHostFile(containerPath, name)
+					Expect(err).ToNot(HaveOccurred())
+
+					hostUID, _ := uidMap.hostID(readID(container, owner, "-u"))
+					hostGID, _ := gidMap.hostID(readID(container, owner, "-g"))
+					Expect(uint64(stat.Uid)).To(Equal(hostUID))
+					Expect(uint64(stat.Gid)).To(Equal(hostGID))
+				})
+			}
+		})
+	})
+
+	Context("in a privileged container", func() {
+		BeforeEach(func() {
+			privilegedContainer = true
+		})
+
+		It("maps every uid and gid to itself", func() {
+			identity := idMap{{containerID: 0, hostID: 0, size: identityMapSize}}
+
+			Expect(readIDMap(container, "uid")).To(Equal(identity))
+			Expect(readIDMap(container, "gid")).To(Equal(identity))
+		})
+	})
+})
+
+// idMapping is one line of /proc/<pid>/uid_map or gid_map.
+type idMapping struct {
+	containerID uint64
+	hostID      uint64
+	size        uint64
+}
+
+func (m idMapping) contains(hostID uint64) bool {
+	return m.hostID <= hostID && hostID < m.hostID+m.size
+}
+
+type idMap []idMapping
+
+// hostID returns the host id that containerID maps to, and false if it is not
+// mapped.
+func (m idMap) hostID(containerID uint64) (uint64, bool) {
+	mapping, ok := m.containing(containerID)
+	if !ok {
+		return 0, false
+	}
+
+	return mapping.hostID + containerID - mapping.containerID, true
+}
+
+// containing returns the mapping that containerID falls in, and false if it is
+// not mapped.
+func (m idMap) containing(containerID uint64) (idMapping, bool) {
+	for _, mapping := range m {
+		if mapping.containerID <= containerID && containerID < mapping.containerID+mapping.size {
+			return mapping, true
+		}
+	}
+
+	return idMapping{}, false
+}
+
+// readIDMap reads the uid or gid map of a process in the container.
+func readIDMap(container garden.Container, kind string) idMap {
+	stdout := gbytes.NewBuffer()
+	Expect(runInContainer(container, "root", fmt.Sprintf("cat /proc/self/%s_map", kind), stdout)).To(Equal(0))
+
+	m := idMap{}
+	for _, line := range strings.Split(strings.TrimSpace(string(stdout.Contents())), "\n") {
+		fields := strings.Fields(line)
+		Expect(fields).To(HaveLen(3), "malformed %s_map line %q", kind, line)
+
+		mapping := idMapping{}
+		for i, value := range []*uint64{&mapping.containerID, &mapping.hostID, &mapping.size} {
+			var err error
+			*value, err = strconv.ParseUint(fields[i], 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		m = append(m, mapping)
+	}
+
+	return m
+}
+
+// readID returns the uid (flag -u) or primary gid (flag -g) of a user in the
+// container, as reported by id(1).
+func readID(container garden.Container, user, flag string) uint64 {
+	stdout := gbytes.NewBuffer()
+	Expect(runInContainer(container, "root", fmt.Sprintf("id %s %s", flag, user), stdout)).To(Equal(0))
+
+	id, err := strconv.ParseUint(strings.TrimSpace(string(stdout.Contents())), 10, 64)
+	Expect(err).ToNot(HaveOccurred())
+
+	return id
+}
+
+// findHostFile looks below a container's depot directory on this host for a
+// file with the given name, and returns its ownership as the host sees it.
+func findHostFile(containerPath, name string) (*syscall.Stat_t, error) {
+	var stat *syscall.Stat_t
+
+	err := filepath.Walk(containerPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || stat != nil {
+			return nil
+		}
+
+		if info.Name() == name {
+			stat = info.Sys().(*syscall.Stat_t)
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if stat == nil {
+		return nil, fmt.Errorf("no %s below %s", name, containerPath)
+	}
+
+	return stat, nil
+}